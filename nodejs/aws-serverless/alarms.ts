@@ -0,0 +1,112 @@
+// Copyright 2016-2018, Pulumi Corporation.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+
+import * as aws from "@pulumi/aws";
+import * as pulumi from "@pulumi/pulumi";
+
+import { mergeTags } from "./utils";
+
+export interface MetricAlarmArgs {
+    /**
+     * The length, in seconds, of the periods the metric is evaluated over.  Defaults to 60.
+     */
+    period?: pulumi.Input<number>;
+
+    /**
+     * The value the metric must reach in a period for it to breach the alarm.  Defaults to 1 for counts of errors and
+     * throttles.
+     */
+    threshold?: pulumi.Input<number>;
+
+    /**
+     * The number of consecutive periods the metric must breach the threshold in for the alarm to fire.  Defaults to 1.
+     */
+    evaluationPeriods?: pulumi.Input<number>;
+}
+
+export interface DurationAlarmArgs extends MetricAlarmArgs {
+    /**
+     * The average duration, in milliseconds, above which the alarm fires.
+     */
+    threshold: pulumi.Input<number>;
+}
+
+export interface FunctionAlarmsArgs {
+    /**
+     * The ARN of the SNS topic notified when an alarm fires, and again once it recovers.
+     */
+    topicArn: pulumi.Input<string>;
+
+    /**
+     * Settings for the alarm on the function's errors, which is always created.
+     */
+    errors?: MetricAlarmArgs;
+
+    /**
+     * Whether, and with what settings, to also alarm when invocations of the function are throttled.
+     */
+    throttles?: boolean | MetricAlarmArgs;
+
+    /**
+     * When given, also alarm when the function's average duration exceeds [duration.threshold].
+     */
+    duration?: DurationAlarmArgs;
+
+    /**
+     * Tags to apply to the alarms, merged with the package-level defaults.
+     */
+    tags?: pulumi.Input<Record<string, pulumi.Input<string>>>;
+}
+
+export interface FunctionAlarms {
+    errors: aws.cloudwatch.MetricAlarm;
+    throttles?: aws.cloudwatch.MetricAlarm;
+    duration?: aws.cloudwatch.MetricAlarm;
+}
+
+/**
+ * createAlarms creates CloudWatch alarms on the metrics of [func], notifying [args.topicArn] when they fire.
+ */
+export function createAlarms(
+    name: string, func: aws.lambda.Function, args: FunctionAlarmsArgs, opts?: pulumi.ResourceOptions): FunctionAlarms {
+
+    const tags = mergeTags(args.tags);
+    const alarm = (metric: string, alarmArgs: MetricAlarmArgs, statistic: string, comparisonOperator: string) =>
+        new aws.cloudwatch.MetricAlarm(`${name}-${metric.toLowerCase()}`, {
+            namespace: "AWS/Lambda",
+            metricName: metric,
+            dimensions: { FunctionName: func.name },
+            statistic: statistic,
+            comparisonOperator: comparisonOperator,
+            threshold: alarmArgs.threshold !== undefined ? alarmArgs.threshold : 1,
+            period: alarmArgs.period !== undefined ? alarmArgs.period : 60,
+            evaluationPeriods: alarmArgs.evaluationPeriods !== undefined ? alarmArgs.evaluationPeriods : 1,
+            // A function that isn't invoked reports no data, which isn't cause for alarm.
+            treatMissingData: "notBreaching",
+            alarmActions: [args.topicArn],
+            okActions: [args.topicArn],
+            tags: tags,
+        }, opts);
+
+    const errors = alarm("Errors", args.errors || {}, "Sum", "GreaterThanOrEqualToThreshold");
+    const throttles = args.throttles
+        ? alarm("Throttles", args.throttles === true ? {} : args.throttles, "Sum", "GreaterThanOrEqualToThreshold")
+        : undefined;
+    const duration = args.duration
+        ? alarm("Duration", args.duration, "Average", "GreaterThanThreshold")
+        : undefined;
+
+    return { errors, throttles, duration };
+}
@@ -15,8 +15,8 @@
 import * as aws from "@pulumi/aws";
 import * as pulumi from "@pulumi/pulumi";
 
-import { createLambdaFunction, Handler } from "./function";
-import { sha1hash } from "./utils";
+import { createFunction, Handler } from "./function";
+import { childOptions, mergeTags, sha1hash } from "./utils";
 
 export interface Request {
     resource: string;
@@ -69,8 +69,143 @@ export type Route = {
     path: string;
     method: Method;
     handler: RouteHandler;
+    /**
+     * A JSON schema that the body of requests to the route must match.  API Gateway rejects requests with a body that
+     * doesn't match with a 400 response, without invoking [handler].
+     */
+    requestSchema?: Record<string, any>;
+    /**
+     * Query string parameters and headers that requests to the route must include.  As with [requestSchema],
+     * requests missing any of them are rejected by API Gateway.
+     */
+    requiredParameters?: {
+        querystring?: string[];
+        headers?: string[];
+    };
+    /**
+     * Whether requests to the route must include a valid API key in the "x-api-key" header.  Keys are created and
+     * associated with the API through [APIArgs.usagePlan].
+     */
+    apiKeyRequired?: boolean;
+};
+
+/**
+ * Cross-origin resource sharing (CORS) settings for an API, allowing browsers on other origins to call it.
+ */
+export interface CorsArgs {
+    /**
+     * The origins allowed to call the API (i.e. "https://example.com"), or "*" for any origin.  REST APIs can only
+     * respond with a single, fixed origin.
+     */
+    allowOrigins: string[];
+    /**
+     * The methods allowed in cross-origin requests.  Defaults to every method.
+     */
+    allowMethods?: string[];
+    /**
+     * The request headers allowed in cross-origin requests.
+     */
+    allowHeaders?: string[];
+    /**
+     * Whether cross-origin requests may include credentials (cookies and authorization headers).
+     */
+    allowCredentials?: boolean;
+    /**
+     * How long, in seconds, browsers may cache the result of a preflight request.
+     */
+    maxAge?: number;
+}
+
+// defaultCors is used when an API is created with the `cors: true` shorthand.
+const defaultCors: CorsArgs = {
+    allowOrigins: ["*"],
+    allowMethods: ["GET", "PUT", "POST", "DELETE", "PATCH", "OPTIONS"],
+    allowHeaders: ["Content-Type", "Authorization", "X-Amz-Date", "X-Api-Key", "X-Amz-Security-Token"],
+    allowCredentials: false,
+    maxAge: 300,
 };
 
+function resolveCors(cors: boolean | CorsArgs | undefined): CorsArgs | undefined {
+    if (cors === true) {
+        return defaultCors;
+    }
+    return cors || undefined;
+}
+
+/**
+ * A custom domain name to serve an API at, instead of its generated execute-api URL.
+ */
+export interface DomainArgs {
+    /**
+     * The fully-qualified domain name (i.e. "api.example.com").
+     */
+    domainName: pulumi.Input<string>;
+    /**
+     * The ARN of an ACM certificate for [domainName].  For EDGE endpoints the certificate must be in us-east-1; for
+     * REGIONAL endpoints it must be in the same region as the API.
+     */
+    certificateArn: pulumi.Input<string>;
+    /**
+     * The path under the domain that the API is served at.  Defaults to the root of the domain.
+     */
+    basePath?: string;
+    /**
+     * Whether the domain is served through CloudFront ("EDGE") or directly from the API's region ("REGIONAL").
+     * Defaults to "EDGE".
+     */
+    endpointType?: "EDGE" | "REGIONAL";
+}
+
+/**
+ * Throttling and quota limits applied to callers of an API, along with the API keys the limits are tracked against.
+ */
+export interface UsagePlanArgs {
+    /**
+     * The steady-state request rate, in requests per second, and the maximum burst of requests allowed per key.
+     */
+    throttle?: {
+        rateLimit?: pulumi.Input<number>;
+        burstLimit?: pulumi.Input<number>;
+    };
+    /**
+     * The maximum number of requests allowed per key in each [period].
+     */
+    quota?: {
+        limit: pulumi.Input<number>;
+        period: pulumi.Input<"DAY" | "WEEK" | "MONTH">;
+        offset?: pulumi.Input<number>;
+    };
+    /**
+     * The names of the API keys to create and associate with the plan, i.e. one per client.
+     */
+    apiKeys?: string[];
+}
+
+/**
+ * Where and how API Gateway logs the requests made to an API's stage.
+ */
+export interface AccessLogArgs {
+    /**
+     * The ARN of the CloudWatch Logs log group or Kinesis Data Firehose stream to write the logs to.
+     */
+    destinationArn: pulumi.Input<string>;
+
+    /**
+     * The format of each log entry, using $context variables.  Defaults to a JSON object of the request's ID, caller,
+     * method, path, status and response length.
+     */
+    format?: pulumi.Input<string>;
+
+    /**
+     * Whether to give API Gateway the role it needs to write to CloudWatch Logs, which must be set up once before any
+     * API in the account can log there.  The role is a setting of the account's API Gateway service in the region,
+     * rather than of an API, so only one API per region should set this, and the role set by the last one to deploy
+     * replaces any set before it.  Logging to Firehose doesn't need the role.  Defaults to false.  This is not an
+     * Input as it determines whether the role is created.
+     */
+    configureAccount?: boolean;
+}
+
 export interface APIArgs {
     /**
      * Routes to use to initialize the APIGateway.
@@ -86,29 +221,121 @@ export interface APIArgs {
      */
     swaggerSpec?: pulumi.Input<string>;
 
+    /**
+     * The name of the stage the API is deployed to, which is the first segment of its URL's path.  Defaults to
+     * "stage".
+     */
     stageName?: pulumi.Input<string>;
+
+    /**
+     * Logs the requests made to the API's stage.
+     */
+    accessLog?: AccessLogArgs;
+
+    /**
+     * Whether API Gateway traces requests to the stage with X-Ray.  Set [FunctionArgs.tracingConfig] on route
+     * handlers as well to follow requests into them.
+     */
+    xrayTracingEnabled?: pulumi.Input<boolean>;
+
+    /**
+     * CORS settings for the API, or `true` to allow any origin to call it.  Preflight requests are answered by API
+     * Gateway, but route handlers must still include an "Access-Control-Allow-Origin" header in their own responses.
+     * Not supported with [swaggerSpec], which must define its own OPTIONS methods.
+     */
+    cors?: boolean | CorsArgs;
+
+    /**
+     * The content types (i.e. "image/png", or wildcards such as "image/*") that API Gateway passes through as
+     * binary, rather than as text.  Route handlers return binary bodies base64-encoded, with
+     * [Response.isBase64Encoded] set.  Defaults to every content type for APIs created from [routes].
+     */
+    binaryMediaTypes?: pulumi.Input<string[]>;
+
+    /**
+     * A custom domain name to serve the API's stage at.  The DNS record pointing the domain at [API.domainTarget] is
+     * left to the caller.
+     */
+    domain?: DomainArgs;
+
+    /**
+     * A usage plan to create for the API's stage, along with its API keys.  Routes using the keys should set
+     * [Route.apiKeyRequired].
+     */
+    usagePlan?: UsagePlanArgs;
+
+    /**
+     * Tags to apply to the API, its stage and any functions created for its routes, in addition to any set with
+     * [setDefaultTags].
+     */
+    tags?: pulumi.Input<Record<string, pulumi.Input<string>>>;
 }
 
+const defaultAccessLogFormat = JSON.stringify({
+    requestId: "$context.requestId",
+    ip: "$context.identity.sourceIp",
+    requestTime: "$context.requestTime",
+    httpMethod: "$context.httpMethod",
+    resourcePath: "$context.resourcePath",
+    status: "$context.status",
+    protocol: "$context.protocol",
+    responseLength: "$context.responseLength",
+});
+
+const apiGatewayRolePolicy = {
+    "Version": "2012-10-17",
+    "Statement": [
+        {
+            "Action": "sts:AssumeRole",
+            "Principal": {
+                "Service": "apigateway.amazonaws.com",
+            },
+            "Effect": "Allow",
+            "Sid": "",
+        },
+    ],
+};
+
 export class API extends pulumi.ComponentResource {
     public restAPI: aws.apigateway.RestApi;
     public deployment: aws.apigateway.Deployment;
     public stage: aws.apigateway.Stage;
+    public domainName?: aws.apigateway.DomainName;
+    public basePathMapping?: aws.apigateway.BasePathMapping;
 
     public url: pulumi.Output<string>;
+    /**
+     * The domain name and hosted zone ID that a DNS alias record for the custom domain should target.  Only set when
+     * [APIArgs.domain] is.
+     */
+    public domainTarget?: pulumi.Output<string>;
+    public domainZoneId?: pulumi.Output<string>;
 
-    constructor(name: string, args: APIArgs, opts?: pulumi.ResourceOptions) {
+    public usagePlan?: aws.apigateway.UsagePlan;
+    public apiKeys?: aws.apigateway.ApiKey[];
+    /**
+     * The values of the keys created for [APIArgs.usagePlan], by name.
+     */
+    public apiKeyValues?: pulumi.Output<Record<string, string>>;
+
+    constructor(name: string, args: APIArgs, opts?: pulumi.ComponentResourceOptions) {
         super("aws-serverless:apigateway:API", name, {}, opts);
 
         let swaggerString: pulumi.Output<string>;
         let swaggerSpec: SwaggerSpec | undefined;
         let lambdas: { [key: string]: aws.lambda.Function };
+        const cors = resolveCors(args.cors);
         if (args.swaggerSpec) {
+            if (cors) {
+                throw new Error("RestAPI cannot specify both `cors` and `swaggerSpec`.");
+            }
             swaggerString = pulumi.output(args.swaggerSpec);
             lambdas = {};
         } else if (args.routes) {
-            const [spec, routeLambdas] = swaggerSpecFromRoutes(name, args.routes);
+            const [spec, routeLambdas] = swaggerSpecFromRoutes(
+                name, args.routes, args.tags, cors, args.binaryMediaTypes, opts);
             swaggerSpec = spec;
-            swaggerString = createSwaggerString(spec);
+            swaggerString = createSwaggerString(spec, cors);
             lambdas = routeLambdas;
         } else {
             throw new Error("RestAPI must specify either `routes` or `swaggerSpec` options to configure the RestAPI.");
@@ -119,7 +346,9 @@ export class API extends pulumi.ComponentResource {
         // Create the API Gateway Rest API, using a swagger spec.
         this.restAPI = new aws.apigateway.RestApi(name, {
             body: swaggerString,
-        }, { parent: this });
+            binaryMediaTypes: args.binaryMediaTypes,
+            tags: mergeTags(args.tags),
+        }, childOptions(this, opts));
 
         // Create a deployment of the Rest API.
         this.deployment = new aws.apigateway.Deployment(name, {
@@ -135,7 +364,7 @@ export class API extends pulumi.ComponentResource {
             variables: {
                 version: swaggerString.apply(sha1hash),
             },
-        }, { parent: this });
+        }, childOptions(this, opts));
 
         // Expose the URL that the API is served at.
         this.url = this.deployment.invokeUrl.apply(url => url + stageName + "/");
@@ -164,19 +393,379 @@ export class API extends pulumi.ComponentResource {
                             // deployed by Pulumi because the API Gateway console "Test" feature invokes the route
                             // handler with the fake stage `test-invoke-stage`.
                             sourceArn: this.deployment.executionArn.apply(arn => arn + "*/" + method + path),
-                        }, { parent: this });
+                        }, childOptions(this, opts));
                         permissions.push(invokePermission);
                     }
                 }
             }
         }
 
+        // API Gateway can only write access logs to CloudWatch Logs once its account has been given a role to do so.
+        const stageDependencies: pulumi.Resource[] = permissions.slice();
+        const accessLog = args.accessLog;
+        if (accessLog && accessLog.configureAccount) {
+            const logsRole = new aws.iam.Role(name + "-logs", {
+                assumeRolePolicy: JSON.stringify(apiGatewayRolePolicy),
+                tags: mergeTags(args.tags),
+            }, childOptions(this, opts));
+            const logsAttachment = new aws.iam.RolePolicyAttachment(name + "-logs", {
+                role: logsRole,
+                policyArn: "arn:aws:iam::aws:policy/service-role/AmazonAPIGatewayPushToCloudWatchLogs",
+            }, childOptions(this, opts));
+            stageDependencies.push(new aws.apigateway.Account(name, {
+                cloudwatchRoleArn: logsRole.arn,
+            }, childOptions(this, opts, [logsAttachment])));
+        }
+
         // Create a stage, which is an addressable instance of the Rest API. Set it to point at the latest deployment.
         this.stage = new aws.apigateway.Stage(name, {
             restApi: this.restAPI,
             deployment: this.deployment,
             stageName: stageName,
-        }, { parent: this, dependsOn: permissions });
+            accessLogSettings: accessLog && {
+                destinationArn: accessLog.destinationArn,
+                format: accessLog.format !== undefined ? accessLog.format : defaultAccessLogFormat,
+            },
+            xrayTracingEnabled: args.xrayTracingEnabled,
+            tags: mergeTags(args.tags),
+        }, childOptions(this, opts, stageDependencies));
+
+        if (args.domain) {
+            const domain = args.domain;
+            const regional = domain.endpointType === "REGIONAL";
+            this.domainName = new aws.apigateway.DomainName(name, {
+                domainName: domain.domainName,
+                certificateArn: regional ? undefined : domain.certificateArn,
+                regionalCertificateArn: regional ? domain.certificateArn : undefined,
+                endpointConfiguration: { types: regional ? "REGIONAL" : "EDGE" },
+                tags: mergeTags(args.tags),
+            }, childOptions(this, opts));
+
+            this.basePathMapping = new aws.apigateway.BasePathMapping(name, {
+                restApi: this.restAPI,
+                stageName: this.stage.stageName,
+                domainName: this.domainName.domainName,
+                basePath: domain.basePath,
+            }, childOptions(this, opts));
+
+            this.domainTarget = regional ? this.domainName.regionalDomainName : this.domainName.cloudfrontDomainName;
+            this.domainZoneId = regional ? this.domainName.regionalZoneId : this.domainName.cloudfrontZoneId;
+        }
+
+        if (args.usagePlan) {
+            const plan = args.usagePlan;
+            this.usagePlan = new aws.apigateway.UsagePlan(name, {
+                apiStages: [{
+                    apiId: this.restAPI.id,
+                    stage: this.stage.stageName,
+                }],
+                throttleSettings: plan.throttle,
+                quotaSettings: plan.quota,
+            }, childOptions(this, opts));
+
+            const keyNames = plan.apiKeys || [];
+            this.apiKeys = [];
+            for (const keyName of keyNames) {
+                const apiKey = new aws.apigateway.ApiKey(name + "-" + keyName, {
+                    tags: mergeTags(args.tags),
+                }, childOptions(this, opts));
+                this.apiKeys.push(apiKey);
+
+                const usagePlanKey = new aws.apigateway.UsagePlanKey(name + "-" + keyName, {
+                    keyId: apiKey.id,
+                    keyType: "API_KEY",
+                    usagePlanId: this.usagePlan.id,
+                }, childOptions(this, opts));
+            }
+
+            this.apiKeyValues = pulumi.all(this.apiKeys.map(k => k.value)).apply(values => {
+                const result: Record<string, string> = {};
+                keyNames.forEach((keyName, i) => result[keyName] = values[i]);
+                return result;
+            });
+        }
+
+        this.registerOutputs({
+            url: this.url,
+            domainTarget: this.domainTarget,
+            domainZoneId: this.domainZoneId,
+            apiKeyValues: this.apiKeyValues,
+        });
+    }
+}
+
+export type HttpRouteHandler = RouteHandler;
+
+export interface HttpRoute {
+    /**
+     * The path of the route (i.e. "/items" or "/items/{id}").
+     */
+    path: string;
+    method: Method;
+    /**
+     * Either a callback to create a function from, or an existing function to route requests to.
+     */
+    handler: HttpRouteHandler;
+}
+
+export interface HttpAPIArgs {
+    /**
+     * Routes to use to initialize the API.
+     */
+    routes: HttpRoute[];
+
+    /**
+     * CORS settings for the API, or `true` to allow any origin to call it.  API Gateway answers preflight requests
+     * and adds the CORS headers to route responses.
+     */
+    cors?: boolean | CorsArgs;
+
+    /**
+     * Tags to apply to the API, its stage and any functions created for its routes, in addition to any set with
+     * [setDefaultTags].
+     */
+    tags?: pulumi.Input<Record<string, pulumi.Input<string>>>;
+}
+
+/**
+ * Creates a new API Gateway HTTP API (v2) that proxies each of the given routes to its function.  HTTP APIs are a
+ * lighter and cheaper alternative to the REST API created by [API], for APIs that don't need its extra features.
+ */
+export function httpApi(name: string, args: HttpAPIArgs, opts?: pulumi.ComponentResourceOptions): HttpAPI {
+    return new HttpAPI(name, args, opts);
+}
+
+export class HttpAPI extends pulumi.ComponentResource {
+    public readonly api: aws.apigatewayv2.Api;
+    public readonly stage: aws.apigatewayv2.Stage;
+    public readonly integrations: aws.apigatewayv2.Integration[];
+    public readonly routes: aws.apigatewayv2.Route[];
+    public readonly permissions: aws.lambda.Permission[];
+
+    public readonly url: pulumi.Output<string>;
+
+    constructor(name: string, args: HttpAPIArgs, opts?: pulumi.ComponentResourceOptions) {
+        super("aws-serverless:apigateway:HttpAPI", name, {}, opts);
+
+        if (args.routes.length === 0) {
+            throw new Error(`HttpAPI '${name}' must specify at least one route.`);
+        }
+
+        const cors = resolveCors(args.cors);
+        this.api = new aws.apigatewayv2.Api(name, {
+            protocolType: "HTTP",
+            corsConfiguration: cors,
+            tags: mergeTags(args.tags),
+        }, childOptions(this, opts));
+
+        this.integrations = [];
+        this.routes = [];
+        this.permissions = [];
+        const seen = new Set<string>();
+        for (const route of args.routes) {
+            const routeKey = route.method + " " + route.path;
+            if (seen.has(routeKey)) {
+                throw new Error(`HttpAPI '${name}' has more than one route for '${routeKey}'.`);
+            }
+            seen.add(routeKey);
+
+            const routeName = name + "-" + sha1hash(routeKey);
+            const { targetArn } = createFunction(
+                routeName, { subscription: name, source: `'${routeKey}' route` }, route.handler, { tags: args.tags },
+                childOptions(this, opts));
+
+            // Payload format 1.0 matches the REST API's proxy integration, so route handlers receive the same
+            // [Request] and return the same [Response] as they would with [API].
+            const integration = new aws.apigatewayv2.Integration(routeName, {
+                apiId: this.api.id,
+                integrationType: "AWS_PROXY",
+                integrationMethod: "POST",
+                integrationUri: targetArn,
+                payloadFormatVersion: "1.0",
+            }, childOptions(this, opts));
+            this.integrations.push(integration);
+
+            this.routes.push(new aws.apigatewayv2.Route(routeName, {
+                apiId: this.api.id,
+                routeKey: routeKey,
+                target: integration.id.apply(id => "integrations/" + id),
+            }, childOptions(this, opts)));
+
+            const method = route.method === "ANY" ? "*" : route.method;
+            this.permissions.push(new aws.lambda.Permission(routeName, {
+                action: "lambda:invokeFunction",
+                function: targetArn,
+                principal: "apigateway.amazonaws.com",
+                // As with [API], allow any stage to invoke the route so that the permission doesn't need to change
+                // if the stage does.
+                sourceArn: this.api.executionArn.apply(arn => arn + "/*/" + method + route.path),
+            }, childOptions(this, opts)));
+        }
+
+        // The $default stage is served at the root of the API's endpoint and deploys every change automatically, so
+        // no explicit aws.apigatewayv2.Deployment is needed.
+        this.stage = new aws.apigatewayv2.Stage(name, {
+            apiId: this.api.id,
+            name: "$default",
+            autoDeploy: true,
+            tags: mergeTags(args.tags),
+        }, childOptions(this, opts, this.routes));
+
+        this.url = this.stage.invokeUrl;
+
+        this.registerOutputs({
+            url: this.url,
+        });
+    }
+}
+
+export interface WebSocketRequest {
+    requestContext: WebSocketRequestContext;
+    headers?: { [header: string]: string; };
+    queryStringParameters?: { [param: string]: string; };
+    body?: string;
+    isBase64Encoded: boolean;
+}
+
+export interface WebSocketRequestContext {
+    routeKey: string;
+    eventType: "CONNECT" | "MESSAGE" | "DISCONNECT";
+    /**
+     * The ID of the connection the request arrived on.  Messages are sent back to the client by posting to this
+     * connection through the API's management endpoint.
+     */
+    connectionId: string;
+    connectedAt: number;
+    domainName: string;
+    stage: string;
+    apiId: string;
+    requestId: string;
+    requestTimeEpoch: number;
+}
+
+export interface WebSocketResponse {
+    statusCode: number;
+    body?: string;
+}
+
+export type WebSocketRouteHandler = Handler<WebSocketRequest, WebSocketResponse | void>;
+
+export interface WebSocketRoute {
+    /**
+     * The route key, i.e. "$connect", "$disconnect", "$default", or a custom key matched by the API's
+     * [routeSelectionExpression].
+     */
+    routeKey: string;
+    /**
+     * Either a callback to create a function from, or an existing function to route messages to.
+     */
+    handler: WebSocketRouteHandler;
+}
+
+export interface WebSocketAPIArgs {
+    /**
+     * Routes to use to initialize the API.
+     */
+    routes: WebSocketRoute[];
+
+    /**
+     * The expression used to pick the route for each incoming message.  Defaults to "$request.body.action", routing
+     * JSON messages by their "action" property.
+     */
+    routeSelectionExpression?: string;
+
+    /**
+     * The name of the stage the API is deployed to.  Defaults to "stage".
+     */
+    stageName?: string;
+
+    /**
+     * Tags to apply to the API, its stage and any functions created for its routes, in addition to any set with
+     * [setDefaultTags].
+     */
+    tags?: pulumi.Input<Record<string, pulumi.Input<string>>>;
+}
+
+/**
+ * Creates a new API Gateway WebSocket API that passes the connection events and messages for each of the given
+ * routes to its function.
+ */
+export function websocketApi(
+    name: string, args: WebSocketAPIArgs, opts?: pulumi.ComponentResourceOptions): WebSocketAPI {
+
+    return new WebSocketAPI(name, args, opts);
+}
+
+export class WebSocketAPI extends pulumi.ComponentResource {
+    public readonly api: aws.apigatewayv2.Api;
+    public readonly stage: aws.apigatewayv2.Stage;
+    public readonly integrations: aws.apigatewayv2.Integration[];
+    public readonly routes: aws.apigatewayv2.Route[];
+    public readonly permissions: aws.lambda.Permission[];
+
+    /**
+     * The wss:// URL clients connect to.
+     */
+    public readonly url: pulumi.Output<string>;
+
+    constructor(name: string, args: WebSocketAPIArgs, opts?: pulumi.ComponentResourceOptions) {
+        super("aws-serverless:apigateway:WebSocketAPI", name, {}, opts);
+
+        if (args.routes.length === 0) {
+            throw new Error(`WebSocketAPI '${name}' must specify at least one route.`);
+        }
+
+        this.api = new aws.apigatewayv2.Api(name, {
+            protocolType: "WEBSOCKET",
+            routeSelectionExpression: args.routeSelectionExpression || "$request.body.action",
+            tags: mergeTags(args.tags),
+        }, childOptions(this, opts));
+
+        this.integrations = [];
+        this.routes = [];
+        this.permissions = [];
+        const seen = new Set<string>();
+        for (const route of args.routes) {
+            if (seen.has(route.routeKey)) {
+                throw new Error(`WebSocketAPI '${name}' has more than one route for '${route.routeKey}'.`);
+            }
+            seen.add(route.routeKey);
+
+            const routeName = name + "-" + sha1hash(route.routeKey);
+            const { targetArn } = createFunction(
+                routeName, { subscription: name, source: `'${route.routeKey}' route` }, route.handler,
+                { tags: args.tags }, childOptions(this, opts));
+
+            const integration = new aws.apigatewayv2.Integration(routeName, {
+                apiId: this.api.id,
+                integrationType: "AWS_PROXY",
+                integrationMethod: "POST",
+                integrationUri: targetArn,
+            }, childOptions(this, opts));
+            this.integrations.push(integration);
+
+            this.routes.push(new aws.apigatewayv2.Route(routeName, {
+                apiId: this.api.id,
+                routeKey: route.routeKey,
+                target: integration.id.apply(id => "integrations/" + id),
+            }, childOptions(this, opts)));
+
+            this.permissions.push(new aws.lambda.Permission(routeName, {
+                action: "lambda:invokeFunction",
+                function: targetArn,
+                principal: "apigateway.amazonaws.com",
+                sourceArn: this.api.executionArn.apply(arn => arn + "/*/" + route.routeKey),
+            }, childOptions(this, opts)));
+        }
+
+        this.stage = new aws.apigatewayv2.Stage(name, {
+            apiId: this.api.id,
+            name: args.stageName || "stage",
+            autoDeploy: true,
+            tags: mergeTags(args.tags),
+        }, childOptions(this, opts, this.routes));
+
+        this.url = this.stage.invokeUrl;
 
         this.registerOutputs({
             url: this.url,
@@ -188,7 +777,21 @@ interface SwaggerSpec {
     swagger: string;
     info: SwaggerInfo;
     paths: { [path: string]: { [method: string]: SwaggerOperation; }; };
-    "x-amazon-apigateway-binary-media-types"?: string[];
+    "x-amazon-apigateway-binary-media-types"?: pulumi.Input<string[]>;
+    definitions?: { [name: string]: Record<string, any> };
+    securityDefinitions?: { [name: string]: SwaggerSecurityDefinition };
+    "x-amazon-apigateway-request-validators"?: { [name: string]: SwaggerRequestValidator };
+}
+
+interface SwaggerSecurityDefinition {
+    type: string;
+    name: string;
+    in: string;
+}
+
+interface SwaggerRequestValidator {
+    validateRequestBody: boolean;
+    validateRequestParameters: boolean;
 }
 
 interface SwaggerInfo {
@@ -197,9 +800,13 @@ interface SwaggerInfo {
 }
 
 interface SwaggerOperation {
+    consumes?: string[];
+    produces?: string[];
     parameters?: any[];
     responses?: { [code: string]: SwaggerResponse };
     "x-amazon-apigateway-integration": ApigatewayIntegration;
+    "x-amazon-apigateway-request-validator"?: string;
+    security?: { [name: string]: string[] }[];
 }
 
 interface SwaggerResponse {
@@ -229,46 +836,126 @@ interface SwaggerAPIGatewayIntegrationResponse {
 
 interface ApigatewayIntegration {
     requestParameters?: any;
+    requestTemplates?: { [contentType: string]: string };
     passthroughBehavior?: string;
-    httpMethod: string;
+    contentHandling?: string;
+    httpMethod?: string;
     type: string;
     responses?: { [pattern: string]: SwaggerAPIGatewayIntegrationResponse };
     connectionType?: string;
-    uri: pulumi.Output<string>;
+    uri?: pulumi.Output<string>;
     credentials?: pulumi.Output<string>;
     connectionId?: pulumi.Output<string>;
 }
 
-function swaggerSpecFromRoutes(name: string, routes: Route[]): [SwaggerSpec, {[key: string]: aws.lambda.Function}] {
-    const swagger: SwaggerSpec = createBaseSpec(name);
-    const lambdas: {[key: string]: aws.lambda.Function} = registerRoutes(this, name, routes, swagger);
+function swaggerSpecFromRoutes(
+    name: string, routes: Route[], tags: pulumi.Input<Record<string, pulumi.Input<string>>> | undefined,
+    cors: CorsArgs | undefined, binaryMediaTypes: pulumi.Input<string[]> | undefined,
+    opts: pulumi.ComponentResourceOptions | undefined): [SwaggerSpec, {[key: string]: aws.lambda.Function}] {
+
+    const swagger: SwaggerSpec = createBaseSpec(name, binaryMediaTypes);
+    const lambdas: {[key: string]: aws.lambda.Function} = registerRoutes(name, routes, swagger, tags, opts);
+    if (binaryMediaTypes !== undefined) {
+        // Have API Gateway decode the base64 bodies returned by route handlers back into binary.
+        for (const path of Object.keys(swagger.paths)) {
+            for (const method of Object.keys(swagger.paths[path])) {
+                swagger.paths[path][method]["x-amazon-apigateway-integration"].contentHandling = "CONVERT_TO_BINARY";
+            }
+        }
+    }
+    if (cors) {
+        for (const path of Object.keys(swagger.paths)) {
+            swagger.paths[path]["options"] = createPathSpecCors(cors);
+        }
+    }
 
     return [swagger, lambdas];
 }
 
-function createBaseSpec(apiName: string): SwaggerSpec {
+function createBaseSpec(apiName: string, binaryMediaTypes: pulumi.Input<string[]> | undefined): SwaggerSpec {
     return {
         swagger: "2.0",
         info: { title: apiName, version: "1.0" },
         paths: {},
-        "x-amazon-apigateway-binary-media-types": [ "*/*" ],
+        "x-amazon-apigateway-binary-media-types": binaryMediaTypes || [ "*/*" ],
     };
 }
 
-function registerRoutes(parent: pulumi.Resource, apiName: string, routes: Route[], swagger: SwaggerSpec): {[key: string]: aws.lambda.Function} {
+function registerRoutes(
+    apiName: string, routes: Route[], swagger: SwaggerSpec,
+    tags: pulumi.Input<Record<string, pulumi.Input<string>>> | undefined,
+    opts: pulumi.ComponentResourceOptions | undefined): {[key: string]: aws.lambda.Function} {
+
     const lambdas: {[key: string]: aws.lambda.Function} = {};
     for (const route of routes) {
         const method: string = swaggerMethod(route.method);
-        const lambda = createLambdaFunction(apiName + sha1hash(method + ":" + route.path), route.handler);
+        // Route functions have never been parented to the API, and parenting them now would change the URNs of
+        // existing stacks' functions.  They do use the API's provider, though.
+        const lambda = createFunction(
+            apiName + sha1hash(method + ":" + route.path),
+            { subscription: apiName, source: `'${route.method} ${route.path}' route` }, route.handler, { tags: tags },
+            { provider: opts && opts.provider }).func;
         lambdas[method + ":" + route.path] = lambda;
         if (!swagger.paths[route.path]) {
             swagger.paths[route.path] = {};
         }
-        swagger.paths[route.path][method] = createPathSpecLambda(lambda);
+        const operation = createPathSpecLambda(lambda);
+        addRequestValidation(swagger, operation, route, method);
+        if (route.apiKeyRequired) {
+            // API Gateway marks a method as requiring a key when it uses an "x-api-key" apiKey security definition.
+            swagger.securityDefinitions = { "api_key": { type: "apiKey", name: "x-api-key", in: "header" } };
+            operation.security = [{ "api_key": [] }];
+        }
+        swagger.paths[route.path][method] = operation;
     }
     return lambdas;
 }
 
+// addRequestValidation adds the route's [requestSchema] and [requiredParameters], if any, to [operation], along with
+// the request validator that has API Gateway enforce them.  The schema and validators are defined in the swagger spec,
+// rather than as separate aws.apigateway.Model and aws.apigateway.RequestValidator resources, as the spec replaces
+// the API's definition wholesale whenever it changes.
+function addRequestValidation(swagger: SwaggerSpec, operation: SwaggerOperation, route: Route, method: string) {
+    const querystring = (route.requiredParameters && route.requiredParameters.querystring) || [];
+    const headers = (route.requiredParameters && route.requiredParameters.headers) || [];
+    const validateBody = route.requestSchema !== undefined;
+    const validateParameters = querystring.length > 0 || headers.length > 0;
+    if (!validateBody && !validateParameters) {
+        return;
+    }
+
+    const parameters: any[] = [];
+    if (route.requestSchema) {
+        // Model names must be alphanumeric.
+        const modelName = "Route" + sha1hash(method + ":" + route.path);
+        swagger.definitions = swagger.definitions || {};
+        swagger.definitions[modelName] = route.requestSchema;
+        operation.consumes = ["application/json"];
+        parameters.push({
+            name: modelName,
+            in: "body",
+            required: true,
+            schema: { $ref: "#/definitions/" + modelName },
+        });
+    }
+    for (const name of querystring) {
+        parameters.push({ name: name, in: "query", required: true, type: "string" });
+    }
+    for (const name of headers) {
+        parameters.push({ name: name, in: "header", required: true, type: "string" });
+    }
+    operation.parameters = parameters;
+
+    const validatorName = validateBody && validateParameters ? "all" : validateBody ? "body-only" : "params-only";
+    const validators = swagger["x-amazon-apigateway-request-validators"] || {};
+    validators[validatorName] = {
+        validateRequestBody: validateBody,
+        validateRequestParameters: validateParameters,
+    };
+    swagger["x-amazon-apigateway-request-validators"] = validators;
+    operation["x-amazon-apigateway-request-validator"] = validatorName;
+}
+
 function swaggerMethod(method: string): string {
     switch (method.toLowerCase()) {
         case "get":
@@ -301,28 +988,107 @@ function createPathSpecLambda(lambda: aws.lambda.Function): SwaggerOperation {
     };
 }
 
-function createSwaggerString(spec: SwaggerSpec): pulumi.Output<string> {
+// corsHeaders returns the CORS response headers, and their quoted static values, for the given settings.
+function corsHeaders(cors: CorsArgs): { [header: string]: string } {
+    if (cors.allowOrigins.length !== 1) {
+        throw new Error("RestAPI CORS settings must specify exactly one origin in `allowOrigins`.");
+    }
+
+    const headers: { [header: string]: string } = {
+        "Access-Control-Allow-Origin": `'${cors.allowOrigins[0]}'`,
+        "Access-Control-Allow-Methods": `'${(cors.allowMethods || ["*"]).join(",")}'`,
+    };
+    if (cors.allowHeaders) {
+        headers["Access-Control-Allow-Headers"] = `'${cors.allowHeaders.join(",")}'`;
+    }
+    if (cors.allowCredentials) {
+        headers["Access-Control-Allow-Credentials"] = "'true'";
+    }
+    if (cors.maxAge !== undefined) {
+        headers["Access-Control-Max-Age"] = `'${cors.maxAge}'`;
+    }
+    return headers;
+}
+
+// createPathSpecCors creates an OPTIONS operation that answers CORS preflight requests with a mock integration.
+function createPathSpecCors(cors: CorsArgs): SwaggerOperation {
+    const headers = corsHeaders(cors);
+    const responseHeaders: { [header: string]: SwaggerHeader } = {};
+    const responseParameters: { [key: string]: string } = {};
+    for (const header of Object.keys(headers)) {
+        responseHeaders[header] = { type: "string" };
+        responseParameters["method.response.header." + header] = headers[header];
+    }
+
+    return {
+        consumes: ["application/json"],
+        produces: ["application/json"],
+        responses: {
+            "200": {
+                description: "CORS preflight response",
+                headers: responseHeaders,
+            },
+        },
+        "x-amazon-apigateway-integration": {
+            type: "mock",
+            passthroughBehavior: "when_no_match",
+            requestTemplates: {
+                "application/json": "{\"statusCode\": 200}",
+            },
+            responses: {
+                "default": {
+                    statusCode: "200",
+                    responseParameters: responseParameters,
+                },
+            },
+        },
+    };
+}
+
+function createSwaggerString(spec: SwaggerSpec, cors: CorsArgs | undefined): pulumi.Output<string> {
+    // Errors raised by API Gateway itself (rather than a route's handler) need the CORS headers too, or browsers will
+    // hide them from the caller.  Undefined values are dropped from the serialized spec.
+    let gatewayResponseParameters: { [key: string]: string } | undefined;
+    if (cors) {
+        gatewayResponseParameters = {};
+        const headers = corsHeaders(cors);
+        for (const header of Object.keys(headers)) {
+            gatewayResponseParameters["gatewayresponse.header." + header] = headers[header];
+        }
+    }
+
     return pulumi.output(spec).apply(s =>
         JSON.stringify({
             swagger: s.swagger,
             info: spec.info,
             paths: s.paths,
             "x-amazon-apigateway-binary-media-types": s["x-amazon-apigateway-binary-media-types"],
+            definitions: s.definitions,
+            securityDefinitions: s.securityDefinitions,
+            "x-amazon-apigateway-request-validators": s["x-amazon-apigateway-request-validators"],
             // Map paths the user doesn't have access to as 404.
             // http://docs.aws.amazon.com/apigateway/latest/developerguide/supported-gateway-response-types.html
             "x-amazon-apigateway-gateway-responses": {
                 "MISSING_AUTHENTICATION_TOKEN": {
                     "statusCode": 404,
+                    "responseParameters": gatewayResponseParameters,
                     "responseTemplates": {
                         "application/json": "{\"message\": \"404 Not found\" }",
                     },
                 },
                 "ACCESS_DENIED": {
                     "statusCode": 404,
+                    "responseParameters": gatewayResponseParameters,
                     "responseTemplates": {
                         "application/json": "{\"message\": \"404 Not found\" }",
                     },
                 },
+                "DEFAULT_4XX": gatewayResponseParameters && {
+                    "responseParameters": gatewayResponseParameters,
+                },
+                "DEFAULT_5XX": gatewayResponseParameters && {
+                    "responseParameters": gatewayResponseParameters,
+                },
             },
         }));
 }
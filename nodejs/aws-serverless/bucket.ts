@@ -12,50 +12,369 @@
 // See the License for the specific language governing permissions and
 // limitations under the License.
 
+import * as aws from "@pulumi/aws";
 import * as pulumi from "@pulumi/pulumi";
 
-import { s3 } from "@pulumi/aws";
-
-/** @deprecated Use [s3.CommonBucketSubscriptionArgs] instead. */
-export type SimpleBucketSubscriptionArgs = s3.CommonBucketSubscriptionArgs;
-/** @deprecated Use [s3.BucketEventSubscriptionArgs] instead. */
-export type BucketSubscriptionArgs = s3.BucketEventSubscriptionArgs;
-/** @deprecated Use [s3.ObjectCreatedSubscriptionArgs] instead. */
-export type BucketPutArgs = s3.ObjectCreatedSubscriptionArgs;
-/** @deprecated Use [s3.ObjectRemovedSubscriptionArgs] instead. */
-export type BucketDeleteArgs = s3.ObjectRemovedSubscriptionArgs;
-/** @deprecated Use [s3.BucketEvent] instead. */
-export type BucketEvent = s3.BucketEvent;
-/** @deprecated Use [s3.BucketRecord] instead. */
-export type BucketRecord = s3.BucketRecord;
-/** @deprecated Use [s3.BucketEventHandler] instead. */
-export type BucketEventHandler = s3.BucketEventHandler;
-
-/** @deprecated Use [s3.Bucket.onObjectCreated] instead. */
+import { createFunction, FunctionArgs, Handler, HandlerFactory } from "./function";
+import { EventSubscription } from "./subscription";
+import { childOptions } from "./utils";
+
+/**
+ * Arguments to help customize a notification subscription for a bucket.
+ */
+export interface SimpleBucketSubscriptionArgs extends FunctionArgs {
+    /**
+     * An optional prefix or suffix to filter down notifications.  See
+     * aws.s3.BucketNotification.lambdaFunctions for more details.
+     */
+    filterPrefix?: string;
+    filterSuffix?: string;
+}
+
+export interface BucketSubscriptionArgs extends SimpleBucketSubscriptionArgs {
+    /**
+     * Events to subscribe to. For example: "s3:ObjectCreated:*".  Cannot be empty.
+     */
+    events: string[];
+}
+
+export interface BucketPutArgs extends SimpleBucketSubscriptionArgs {
+    /**
+     * The specific event type to subscribe to.  Events of this type are raised when an object is created in the
+     * bucket.  Defaults to "*" (all created events).
+     */
+    event?: "*" | "Put" | "Post" | "Copy" | "CompleteMultipartUpload";
+
+    /**
+     * The prefix and suffix of the objects the handler itself writes back to the bucket.  S3 notifications can't
+     * exclude keys, so events for these objects are instead dropped before the handler is called, preventing it from
+     * triggering itself indefinitely.  A warning is raised when they overlap [filterPrefix] and [filterSuffix], as
+     * the function is then still invoked for every object it writes.
+     */
+    skipPrefix?: string;
+    skipSuffix?: string;
+}
+
+export interface BucketDeleteArgs extends SimpleBucketSubscriptionArgs {
+    /**
+     * The specific event type to subscribe to.  Events of this type are raised when an object is removed from the
+     * bucket.  Defaults to "*" (all removed events).
+     */
+    event?: "*" | "Delete" | "DeleteMarkerCreated";
+}
+
+export interface BucketEvent {
+    Records?: BucketRecord[];
+}
+
+export interface BucketRecord {
+    eventVersion: string;
+    eventSource: string;
+    awsRegion: string;
+    eventTime: string;
+    eventName: string;
+    userIdentity: {
+        principalId: string;
+    };
+    requestParameters: {
+        sourceIPAddress: string;
+    };
+    responseElements: {
+        "x-amz-request-id": string;
+        "x-amz-id-2": string;
+    };
+    s3: {
+        s3SchemaVersion: string;
+        configurationId: string;
+        bucket: {
+            name: string;
+            ownerIdentity: {
+                principalId: string;
+            };
+            arn: string;
+        };
+        object: {
+            key: string;
+            size: number;
+            eTag: string;
+            versionId?: string;
+            sequencer: string;
+        };
+    };
+}
+
+export type BucketEventHandler = Handler<BucketEvent, void>;
+
+/**
+ * Creates a new subscription to the given bucket using the handler provided, along with optional options to control
+ * the behavior of the subscription.  The handler will be called whenever an object is created in the bucket.
+ */
+export function onObjectCreated(
+    name: string, bucket: aws.s3.Bucket, handler: BucketEventHandler,
+    args?: BucketPutArgs, opts?: pulumi.ComponentResourceOptions): BucketEventSubscription {
+
+    const { event, skipPrefix, skipSuffix, ...rest } = args || <BucketPutArgs>{};
+    const argsCopy = {
+        ...rest,
+        events: ["s3:ObjectCreated:" + (event || "*")],
+    };
+
+    if (skipPrefix === undefined && skipSuffix === undefined) {
+        return onEvent(name, bucket, handler, argsCopy, opts);
+    }
+
+    const subscription = onEvent(name, bucket, skipObjects(handler, skipPrefix, skipSuffix), argsCopy, opts);
+    if (filtersOverlap(rest.filterPrefix, rest.filterSuffix, skipPrefix, skipSuffix)) {
+        pulumi.log.warn(
+            `Subscription '${name}' is triggered by objects it writes (skipPrefix '${skipPrefix || ""}', ` +
+            `skipSuffix '${skipSuffix || ""}').  They are skipped, but the function is still invoked for each one; ` +
+            `write them outside filterPrefix/filterSuffix to avoid this.`, subscription);
+    }
+    return subscription;
+}
+
+// skipObjects wraps [handler] so that it is not called with records for objects matching [skipPrefix] and
+// [skipSuffix].  Existing functions can't be wrapped, and are returned as is.
+function skipObjects(
+    handler: BucketEventHandler, skipPrefix: string | undefined, skipSuffix: string | undefined): BucketEventHandler {
+
+    if (handler instanceof HandlerFactory) {
+        const factory = handler.factory;
+        return new HandlerFactory<BucketEvent, void>(
+            handler.captures, resolved => skipRecords(factory(resolved), skipPrefix, skipSuffix));
+    }
+
+    if (typeof handler !== "function") {
+        return handler;
+    }
+
+    return skipRecords(handler, skipPrefix, skipSuffix);
+}
+
+// skipRecords wraps [callback] so that it is not called with records for objects matching [skipPrefix] and
+// [skipSuffix].  It is kept separate from skipObjects so that only the wrapper is serialized into the function.
+function skipRecords(
+    callback: aws.lambda.Callback<BucketEvent, void>, skipPrefix: string | undefined,
+    skipSuffix: string | undefined): aws.lambda.Callback<BucketEvent, void> {
+
+    return (event: BucketEvent, context: aws.lambda.Context, cb: (error: any, result: any) => void) => {
+        const records = (event.Records || []).filter(record => {
+            const key = record.s3.object.key;
+            return !(key.startsWith(skipPrefix || "") && key.endsWith(skipSuffix || ""));
+        });
+        if (records.length === 0) {
+            return Promise.resolve();
+        }
+        return callback({ ...event, Records: records }, context, cb);
+    };
+}
+
+/**
+ * Creates a new subscription to the given bucket using the handler provided, along with optional options to control
+ * the behavior of the subscription.  The handler will be called whenever an object is removed from the bucket.
+ */
+export function onObjectRemoved(
+    name: string, bucket: aws.s3.Bucket, handler: BucketEventHandler,
+    args?: BucketDeleteArgs, opts?: pulumi.ComponentResourceOptions): BucketEventSubscription {
+
+    const { event, ...rest } = args || <BucketDeleteArgs>{};
+    const argsCopy = {
+        ...rest,
+        events: ["s3:ObjectRemoved:" + (event || "*")],
+    };
+
+    return onEvent(name, bucket, handler, argsCopy, opts);
+}
+
+/** @deprecated Use [onObjectCreated] instead. */
 export function onPut(
-    name: string, bucket: s3.Bucket, handler: BucketEventHandler,
-    args?: BucketPutArgs, opts?: pulumi.ResourceOptions): BucketEventSubscription {
+    name: string, bucket: aws.s3.Bucket, handler: BucketEventHandler,
+    args?: BucketPutArgs, opts?: pulumi.ComponentResourceOptions): BucketEventSubscription {
 
-    return bucket.onObjectCreated(name, handler, args, opts);
+    return onObjectCreated(name, bucket, handler, args, opts);
 }
 
-/** @deprecated Use [s3.Bucket.onObjectRemoved] instead. */
+/** @deprecated Use [onObjectRemoved] instead. */
 export function onDelete(
-    name: string, bucket: s3.Bucket, handler: BucketEventHandler,
-    args?: BucketDeleteArgs, opts?: pulumi.ResourceOptions): BucketEventSubscription {
+    name: string, bucket: aws.s3.Bucket, handler: BucketEventHandler,
+    args?: BucketDeleteArgs, opts?: pulumi.ComponentResourceOptions): BucketEventSubscription {
 
-    return bucket.onObjectRemoved(name, handler, args, opts);
+    return onObjectRemoved(name, bucket, handler, args, opts);
 }
 
-/** @deprecated Use [s3.Bucket.onEvent] instead. */
+/**
+ * Creates a new subscription to the given bucket using the handler provided, along with optional options to control
+ * the behavior of the subscription.  The handler will be called whenever one of the requested [args.events] is raised
+ * by the bucket.
+ */
 export function onEvent(
-    name: string, bucket: s3.Bucket, handler: BucketEventHandler,
-    args: BucketSubscriptionArgs, opts?: pulumi.ResourceOptions): BucketEventSubscription {
+    name: string, bucket: aws.s3.Bucket, handler: BucketEventHandler,
+    args: BucketSubscriptionArgs, opts?: pulumi.ComponentResourceOptions): BucketEventSubscription {
 
-    return bucket.onEvent(name, handler, args, opts);
+    return new BucketEventSubscription(name, bucket, handler, args, opts);
 }
 
-/** @deprecated Use [s3.BucketEventSubscription] instead. */
-export const BucketEventSubscription = s3.BucketEventSubscription;
-/** @deprecated Use [s3.BucketEventSubscription] instead. */
-export type BucketEventSubscription = s3.BucketEventSubscription;
+interface SubscriptionInfo {
+    name: string;
+    events: string[];
+    filterPrefix?: string;
+    filterSuffix?: string;
+    lambdaFunctionArn: pulumi.Output<string>;
+    // The permission allowing the bucket to invoke the function.  S3 rejects a notification configuration targeting a
+    // function it can't invoke, so the notification depends on it.
+    permission: aws.lambda.Permission;
+}
+
+interface BucketInfo {
+    bucket: aws.s3.Bucket;
+    subscriptions: SubscriptionInfo[];
+    // Set once the merged notification for the bucket has been created.  No further subscriptions may be added after
+    // that point.
+    notification?: aws.s3.BucketNotification;
+}
+
+// S3 only allows a single notification configuration per bucket, and each BucketNotification resource replaces the
+// configuration wholesale.  So rather than having every subscription create its own BucketNotification (clobbering
+// the others), we record all subscriptions for a bucket here, keyed by the bucket's URN, and create one merged
+// notification per bucket once the program has finished registering its subscriptions.
+const bucketInfos = new Map<string, BucketInfo>();
+
+process.on("beforeExit", createBucketNotifications);
+
+function createBucketNotifications() {
+    for (const [urn, bucketInfo] of bucketInfos) {
+        if (bucketInfo.notification) {
+            continue;
+        }
+
+        // The bucket's configuration is shared by the old and new notification when one is replaced, and creating the
+        // new one before deleting the old makes S3 reject it as conflicting, so the old is always deleted first.
+        const bucketName = urn.substring(urn.lastIndexOf("::") + 2);
+        bucketInfo.notification = new aws.s3.BucketNotification(bucketName, {
+            bucket: bucketInfo.bucket.id,
+            lambdaFunctions: bucketInfo.subscriptions.map(info => ({
+                events: info.events,
+                filterPrefix: info.filterPrefix,
+                filterSuffix: info.filterSuffix,
+                lambdaFunctionArn: info.lambdaFunctionArn,
+            })),
+        }, {
+            parent: bucketInfo.bucket,
+            dependsOn: bucketInfo.subscriptions.map(info => info.permission),
+            deleteBeforeReplace: true,
+        });
+    }
+}
+
+function addSubscription(bucket: aws.s3.Bucket, info: SubscriptionInfo) {
+    bucket.urn.apply(urn => {
+        let bucketInfo = bucketInfos.get(urn);
+        if (!bucketInfo) {
+            bucketInfo = { bucket: bucket, subscriptions: [] };
+            bucketInfos.set(urn, bucketInfo);
+        }
+
+        if (bucketInfo.notification) {
+            throw new Error(
+                `Subscription '${info.name}' was added to bucket '${urn}' after its notification was created.`);
+        }
+
+        for (const existing of bucketInfo.subscriptions) {
+            if (subscriptionsOverlap(existing, info)) {
+                throw new Error(
+                    `Subscriptions '${existing.name}' and '${info.name}' on bucket '${urn}' have overlapping ` +
+                    `events and prefix/suffix filters.  S3 cannot route an event to more than one handler.`);
+            }
+        }
+
+        bucketInfo.subscriptions.push(info);
+    });
+}
+
+function subscriptionsOverlap(a: SubscriptionInfo, b: SubscriptionInfo): boolean {
+    const eventsOverlap = a.events.some(ae => b.events.some(be => eventTypesOverlap(ae, be)));
+    if (!eventsOverlap) {
+        return false;
+    }
+
+    return filtersOverlap(a.filterPrefix, a.filterSuffix, b.filterPrefix, b.filterSuffix);
+}
+
+// filtersOverlap returns true if some key can match both of the given prefix/suffix filters.
+function filtersOverlap(
+    aPrefix: string | undefined, aSuffix: string | undefined,
+    bPrefix: string | undefined, bSuffix: string | undefined): boolean {
+
+    // An absent filter matches every key, so it overlaps with any other filter.
+    aPrefix = aPrefix || "";
+    bPrefix = bPrefix || "";
+    aSuffix = aSuffix || "";
+    bSuffix = bSuffix || "";
+
+    const prefixesOverlap = aPrefix.startsWith(bPrefix) || bPrefix.startsWith(aPrefix);
+    const suffixesOverlap = aSuffix.endsWith(bSuffix) || bSuffix.endsWith(aSuffix);
+    return prefixesOverlap && suffixesOverlap;
+}
+
+// eventTypesOverlap returns true if the two S3 event types can match the same event.  A trailing wildcard (i.e.
+// "s3:ObjectCreated:*") matches every event type that shares its prefix.
+function eventTypesOverlap(a: string, b: string): boolean {
+    if (a === b) {
+        return true;
+    }
+    if (a.endsWith("*") && b.startsWith(a.substring(0, a.length - 1))) {
+        return true;
+    }
+    if (b.endsWith("*") && a.startsWith(b.substring(0, b.length - 1))) {
+        return true;
+    }
+    return false;
+}
+
+/**
+ * A component corresponding to a single underlying aws.s3.BucketNotification created for a bucket.  Note: due to
+ * the AWS requirement that all notifications for a bucket be defined at once, the actual
+ * aws.s3.BucketNotification instances will only be created once the pulumi program runs to completion and all
+ * subscriptions have been heard about.
+ */
+export class BucketEventSubscription extends EventSubscription {
+    public readonly bucket: aws.s3.Bucket;
+
+    public constructor(
+        name: string, bucket: aws.s3.Bucket, handler: BucketEventHandler,
+        args: BucketSubscriptionArgs, opts?: pulumi.ComponentResourceOptions) {
+
+        super("aws-serverless:bucket:BucketEventSubscription", name, { bucket: bucket }, opts);
+
+        if (args.events.length === 0) {
+            throw new Error(`Subscription '${name}' must specify at least one bucket event.`);
+        }
+
+        this.bucket = bucket;
+        const { func, role, functionUrl, targetArn } = createFunction(
+            name + "-bucket-subscription", { subscription: name, source: "bucket" },
+            handler, args, childOptions(this, opts));
+        this.func = func;
+        this.role = role;
+        this.functionUrl = functionUrl && functionUrl.functionUrl;
+
+        this.permission = new aws.lambda.Permission(name, {
+            function: targetArn,
+            action: "lambda:InvokeFunction",
+            principal: "s3.amazonaws.com",
+            // We restrict the permission to only apply to events raised by this specific bucket.
+            sourceArn: bucket.arn,
+        }, childOptions(this, opts));
+
+        addSubscription(bucket, {
+            name: name,
+            events: args.events,
+            filterPrefix: args.filterPrefix,
+            filterSuffix: args.filterSuffix,
+            lambdaFunctionArn: targetArn,
+            permission: this.permission,
+        });
+
+        this.registerOutputs();
+    }
+}
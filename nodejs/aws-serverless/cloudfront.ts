@@ -0,0 +1,156 @@
+// Copyright 2016-2018, Pulumi Corporation.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+
+import * as aws from "@pulumi/aws";
+import * as pulumi from "@pulumi/pulumi";
+
+import { createEdgeFunction, FunctionArgs } from "./function";
+import { EventSubscription } from "./subscription";
+import { childOptions } from "./utils";
+
+export type EdgeEventType = "viewer-request" | "viewer-response" | "origin-request" | "origin-response";
+
+export interface CloudFrontEvent {
+    Records: CloudFrontRecord[];
+}
+
+export interface CloudFrontRecord {
+    cf: {
+        config: {
+            distributionDomainName: string;
+            distributionId: string;
+            eventType: EdgeEventType;
+            requestId: string;
+        };
+        request: CloudFrontRequest;
+        // Only present for viewer-response and origin-response events.
+        response?: CloudFrontResponse;
+    };
+}
+
+/**
+ * Headers keyed by their lowercased name, each with the values it was sent with.
+ */
+export type CloudFrontHeaders = Record<string, { key?: string; value: string }[]>;
+
+export interface CloudFrontRequest {
+    clientIp: string;
+    method: string;
+    uri: string;
+    querystring: string;
+    headers: CloudFrontHeaders;
+    // Only present when the subscription sets [includeBody].
+    body?: {
+        inputTruncated: boolean;
+        action: "read-only" | "replace";
+        encoding: "base64" | "text";
+        data: string;
+    };
+    // Only present for origin-request and origin-response events.
+    origin?: Record<string, any>;
+}
+
+export interface CloudFrontResponse {
+    status: string;
+    statusDescription?: string;
+    headers: CloudFrontHeaders;
+    body?: string;
+    bodyEncoding?: "base64" | "text";
+}
+
+/**
+ * Edge handlers must be callbacks, so that the function can be created where and how Lambda@Edge requires.  Request
+ * handlers return the request to forward, or a response to answer it with; response handlers return the response.
+ */
+export type EdgeEventHandler = aws.lambda.Callback<CloudFrontEvent, CloudFrontRequest | CloudFrontResponse>;
+
+export interface EdgeEventArgs extends FunctionArgs {
+    /**
+     * The CloudFront event the handler runs for.
+     */
+    distributionEventType: EdgeEventType;
+
+    /**
+     * Whether request events include the request body.  Not supported for response events.
+     */
+    includeBody?: boolean;
+}
+
+/**
+ * Creates a function to run at CloudFront edge locations for the given event.  The function is always created in
+ * us-east-1, as Lambda@Edge requires.  CloudFront isn't subscribed for you: attach the result's
+ * [lambdaFunctionAssociation] to a cache behavior of your distribution.
+ */
+export function onEvent(
+    name: string, args: EdgeEventArgs, handler: EdgeEventHandler,
+    opts?: pulumi.ComponentResourceOptions): EdgeEventSubscription {
+
+    return new EdgeEventSubscription(name, args, handler, opts);
+}
+
+export class EdgeEventSubscription extends EventSubscription {
+    public readonly eventType: EdgeEventType;
+    /**
+     * The ARN of the published version of [func], which CloudFront requires.
+     */
+    public readonly qualifiedArn: pulumi.Output<string>;
+    /**
+     * The entry for a cache behavior's lambdaFunctionAssociations attaching the handler to it.
+     */
+    public readonly lambdaFunctionAssociation: pulumi.Output<{
+        eventType: EdgeEventType;
+        lambdaArn: string;
+        includeBody: boolean;
+    }>;
+
+    public constructor(
+        name: string, args: EdgeEventArgs, handler: EdgeEventHandler, opts?: pulumi.ComponentResourceOptions) {
+
+        super("aws-serverless:cloudfront:EdgeEventSubscription", name, {}, opts);
+
+        const { distributionEventType, includeBody, ...functionArgs } = args;
+        if (functionArgs.environment !== undefined) {
+            throw new Error(
+                `Subscription '${name}' sets environment variables, which Lambda@Edge functions don't support.`);
+        }
+        if (functionArgs.architecture === "arm64") {
+            throw new Error(
+                `Subscription '${name}' sets an architecture of arm64, but Lambda@Edge only supports x86_64.`);
+        }
+        if (includeBody && distributionEventType.endsWith("-response")) {
+            throw new Error(
+                `Subscription '${name}' sets includeBody, which isn't supported for ${distributionEventType} events.`);
+        }
+
+        // Lambda@Edge replicates functions from us-east-1, regardless of the region the rest of the program uses.
+        const provider = new aws.Provider(name + "-us-east-1", { region: "us-east-1" }, childOptions(this, opts));
+
+        const { func, role } = createEdgeFunction(
+            name + "-edge-subscription", { subscription: name, source: "CloudFront" },
+            handler, functionArgs, { ...childOptions(this, opts), provider: provider });
+        this.func = func;
+        this.role = role;
+
+        this.eventType = distributionEventType;
+        this.qualifiedArn = func.qualifiedArn;
+        this.lambdaFunctionAssociation = func.qualifiedArn.apply(arn => ({
+            eventType: distributionEventType,
+            lambdaArn: arn,
+            includeBody: !!includeBody,
+        }));
+
+        this.registerOutputs();
+    }
+}
@@ -12,32 +12,202 @@
 // See the License for the specific language governing permissions and
 // limitations under the License.
 
+import * as aws from "@pulumi/aws";
 import * as pulumi from "@pulumi/pulumi";
 
-import { cloudwatch } from "@pulumi/aws";
-
-/** @deprecated Use [cloudwatch.EventRuleEventSubscriptionArgs] instead */
-export type CloudwatchEventArgs = cloudwatch.EventRuleEventSubscriptionArgs;
-/** @deprecated Use [cloudwatch.EventRuleEvent] instead */
-export type CloudwatchEvent = cloudwatch.EventRuleEvent;
-/** @deprecated Use [cloudwatch.EventRuleEventHandler] instead */
-export type CloudwatchEventHandler = cloudwatch.EventRuleEventHandler;
-/** @deprecated Use [cloudwatch.onSubscribe] or [cloudwatch.EventRule.onEvent] instead */
-export function onEvent(name: string, schedule: string, handler: CloudwatchEventHandler, args?: CloudwatchEventArgs, opts?: pulumi.ResourceOptions): CloudwatchEventSubscription;
-export function onEvent(name: string, rule: cloudwatch.EventRule, handler: CloudwatchEventHandler, args?: CloudwatchEventArgs, opts?: pulumi.ResourceOptions): CloudwatchEventSubscription;
+import { createFunction, FunctionArgs, Handler } from "./function";
+import { EventSubscription } from "./subscription";
+import { childOptions, mergeTags } from "./utils";
+
+export interface CloudwatchEventArgs extends FunctionArgs {
+}
+
+export interface CloudwatchEvent {
+    id: string;
+    version: string;
+    account: string;
+    time: string;
+    region: string;
+    resources: string[];
+    source: string;
+    "detail-type": string;
+    detail: any;
+}
+
+/** An alias for [CloudwatchEvent], matching the name AWS uses for events raised by a schedule. */
+export type ScheduledEvent = CloudwatchEvent;
+export type CloudwatchEventHandler = Handler<CloudwatchEvent, void>;
+
+/**
+ * An EventBridge event pattern to create a rule for.  See
+ * https://docs.aws.amazon.com/eventbridge/latest/userguide/eb-event-patterns.html for the pattern syntax.
+ */
+export interface EventPattern {
+    /**
+     * The pattern events must match, i.e. { source: ["aws.ec2"] }.  Objects are serialized to JSON.
+     */
+    eventPattern: pulumi.Input<string | Record<string, any>>;
+
+    /**
+     * The name of the event bus to match events on.  Defaults to the account's default event bus.
+     */
+    eventBusName?: pulumi.Input<string>;
+}
+
+/**
+ * Creates a new subscription to the given schedule, event pattern or existing rule using the handler provided, along
+ * with optional options to control the behavior of the subscription.  When a schedule expression (i.e. "rate(1
+ * minute)") or event pattern is given, an aws.cloudwatch.EventRule is created for it.
+ */
+export function onEvent(name: string, schedule: string, handler: CloudwatchEventHandler, args?: CloudwatchEventArgs, opts?: pulumi.ComponentResourceOptions): CloudwatchEventSubscription;
+export function onEvent(name: string, pattern: EventPattern, handler: CloudwatchEventHandler, args?: CloudwatchEventArgs, opts?: pulumi.ComponentResourceOptions): CloudwatchEventSubscription;
+export function onEvent(name: string, rule: aws.cloudwatch.EventRule, handler: CloudwatchEventHandler, args?: CloudwatchEventArgs, opts?: pulumi.ComponentResourceOptions): CloudwatchEventSubscription;
 export function onEvent(
-    name: string, scheduleOrRule: string | cloudwatch.EventRule,
-    handler: CloudwatchEventHandler, args?: CloudwatchEventArgs, opts?: pulumi.ResourceOptions): CloudwatchEventSubscription {
+    name: string, source: string | EventPattern | aws.cloudwatch.EventRule,
+    handler: CloudwatchEventHandler, args?: CloudwatchEventArgs, opts?: pulumi.ComponentResourceOptions): CloudwatchEventSubscription {
+
+    return new CloudwatchEventSubscription(name, source, handler, args, opts);
+}
+
+export class CloudwatchEventSubscription extends EventSubscription {
+    public readonly eventRule: aws.cloudwatch.EventRule;
+    public readonly target: aws.cloudwatch.EventTarget;
+
+    public constructor(
+        name: string, source: string | EventPattern | aws.cloudwatch.EventRule,
+        handler: CloudwatchEventHandler, args?: CloudwatchEventArgs, opts?: pulumi.ComponentResourceOptions) {
+
+        super("aws-serverless:cloudwatch:CloudwatchEventSubscription", name, {}, opts);
+
+        args = args || {};
+
+        if (typeof source === "string") {
+            this.eventRule = new aws.cloudwatch.EventRule(name, {
+                scheduleExpression: source,
+                tags: mergeTags(args.tags),
+            }, childOptions(this, opts));
+        } else if (source instanceof aws.cloudwatch.EventRule) {
+            this.eventRule = source;
+        } else {
+            this.eventRule = new aws.cloudwatch.EventRule(name, {
+                eventPattern: pulumi.output(source.eventPattern).apply(
+                    p => typeof p === "string" ? p : JSON.stringify(p)),
+                eventBusName: source.eventBusName,
+                tags: mergeTags(args.tags),
+            }, childOptions(this, opts));
+        }
+
+        const { func, role, functionUrl, targetArn } = createFunction(
+            name + "-event-subscription", { subscription: name, source: "CloudWatch" },
+            handler, args, childOptions(this, opts));
+        this.func = func;
+        this.role = role;
+        this.functionUrl = functionUrl && functionUrl.functionUrl;
+
+        this.permission = new aws.lambda.Permission(name, {
+            action: "lambda:invokeFunction",
+            function: targetArn,
+            principal: "events.amazonaws.com",
+            sourceArn: this.eventRule.arn,
+        }, childOptions(this, opts));
+
+        this.target = new aws.cloudwatch.EventTarget(name, {
+            rule: this.eventRule.name,
+            eventBusName: this.eventRule.eventBusName,
+            arn: targetArn,
+            targetId: name,
+        }, childOptions(this, opts));
+
+        this.subscription = this.target;
 
-    if (typeof scheduleOrRule === "string") {
-        return cloudwatch.onSchedule(name, scheduleOrRule, handler, args, opts);
+        this.registerOutputs();
     }
+}
+
+/**
+ * The event a log group subscription's handler is invoked with.  [awslogs.data] is a base64 encoded, gzipped JSON
+ * document with the shape of [DecodedLogGroupEvent].
+ */
+export interface LogGroupEvent {
+    awslogs: {
+        data: string;
+    };
+}
+
+/**
+ * The contents of [LogGroupEvent.awslogs.data] once decompressed and parsed.
+ */
+export interface DecodedLogGroupEvent {
+    messageType: "DATA_MESSAGE" | "CONTROL_MESSAGE";
+    owner: string;
+    logGroup: string;
+    logStream: string;
+    subscriptionFilters: string[];
+    logEvents: {
+        id: string;
+        timestamp: number;
+        message: string;
+    }[];
+}
 
-    return scheduleOrRule.onEvent(name, handler, args, opts);
+export type LogGroupEventHandler = Handler<LogGroupEvent, void>;
+
+export interface LogGroupEventArgs extends FunctionArgs {
+    /**
+     * The filter pattern log events must match to be delivered to the handler.  Defaults to "", which matches all
+     * events.  See https://docs.aws.amazon.com/AmazonCloudWatch/latest/logs/FilterAndPatternSyntax.html.
+     */
+    filterPattern?: pulumi.Input<string>;
 }
 
-/** @deprecated Use [cloudwatch.EventRuleEventSubscription] instead */
-// tslint:disable-next-line:variable-name
-export const CloudwatchEventSubscription = cloudwatch.EventRuleEventSubscription;
-/** @deprecated Use [cloudwatch.EventRuleEventSubscription] instead */
-export type CloudwatchEventSubscription = cloudwatch.EventRuleEventSubscription;
+/**
+ * Creates a new subscription to the given log group using the handler provided, along with optional options to
+ * control the behavior of the subscription.
+ */
+export function onLogEvent(
+    name: string, logGroup: aws.cloudwatch.LogGroup, handler: LogGroupEventHandler,
+    args?: LogGroupEventArgs, opts?: pulumi.ComponentResourceOptions): LogGroupEventSubscription {
+
+    return new LogGroupEventSubscription(name, logGroup, handler, args, opts);
+}
+
+export class LogGroupEventSubscription extends EventSubscription {
+    public readonly logGroup: aws.cloudwatch.LogGroup;
+    public readonly subscriptionFilter: aws.cloudwatch.LogSubscriptionFilter;
+
+    public constructor(
+        name: string, logGroup: aws.cloudwatch.LogGroup, handler: LogGroupEventHandler,
+        args?: LogGroupEventArgs, opts?: pulumi.ComponentResourceOptions) {
+
+        super("aws-serverless:cloudwatch:LogGroupEventSubscription", name, { logGroup: logGroup }, opts);
+
+        args = args || {};
+
+        this.logGroup = logGroup;
+        const { func, role, functionUrl, targetArn } = createFunction(
+            name + "-log-subscription", { subscription: name, source: "log group" },
+            handler, args, childOptions(this, opts));
+        this.func = func;
+        this.role = role;
+        this.functionUrl = functionUrl && functionUrl.functionUrl;
+
+        this.permission = new aws.lambda.Permission(name, {
+            action: "lambda:invokeFunction",
+            function: targetArn,
+            principal: "logs.amazonaws.com",
+            sourceArn: logGroup.arn.apply(arn => arn.endsWith(":*") ? arn : arn + ":*"),
+        }, childOptions(this, opts));
+
+        // CloudWatch Logs verifies it can invoke the function when the filter is created, so the permission must
+        // exist first.
+        this.subscriptionFilter = new aws.cloudwatch.LogSubscriptionFilter(name, {
+            logGroup: logGroup.name,
+            destinationArn: targetArn,
+            filterPattern: args.filterPattern !== undefined ? args.filterPattern : "",
+        }, childOptions(this, opts, [this.permission]));
+
+        this.subscription = this.subscriptionFilter;
+
+        this.registerOutputs();
+    }
+}
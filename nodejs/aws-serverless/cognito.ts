@@ -0,0 +1,196 @@
+// Copyright 2016-2018, Pulumi Corporation.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+
+import * as aws from "@pulumi/aws";
+import * as pulumi from "@pulumi/pulumi";
+
+import { createFunction, FunctionArgs, Handler } from "./function";
+import { EventSubscription } from "./subscription";
+import { childOptions } from "./utils";
+
+/**
+ * The event passed to every user pool trigger.  The shape of [request] and [response] depends on the trigger; see
+ * "Customizing user pool workflows with Lambda triggers" in the Cognito developer guide.
+ */
+export interface TriggerEvent {
+    version: string;
+    triggerSource: string;
+    region: string;
+    userPoolId: string;
+    userName?: string;
+    callerContext: {
+        awsSdkVersion: string;
+        clientId: string;
+    };
+    request: Record<string, any>;
+    response: Record<string, any>;
+}
+
+/**
+ * Handler for a user pool trigger.  Handlers return the event they were given, with [TriggerEvent.response] filled in
+ * as the trigger requires.
+ */
+export type TriggerEventHandler = Handler<TriggerEvent, TriggerEvent>;
+
+/**
+ * The user pool triggers a function can be attached to, named as in aws.cognito.UserPool.lambdaConfig.
+ */
+export type TriggerName =
+    "preSignUp" | "postConfirmation" | "preAuthentication" | "postAuthentication" | "preTokenGeneration" |
+    "customMessage" | "defineAuthChallenge" | "createAuthChallenge" | "verifyAuthChallengeResponse" | "userMigration";
+
+export interface TriggerArgs extends FunctionArgs {
+}
+
+interface UserPoolInfo {
+    name: string;
+    triggers: Record<string, pulumi.Output<string>>;
+    // Resolves the pool's lambdaConfig once the program has finished registering its triggers.
+    resolve: (triggers: Record<string, pulumi.Output<string>>) => void;
+    resolved: boolean;
+}
+
+// A user pool's triggers are all set through its lambdaConfig, which AWS replaces wholesale on every update.  So
+// pools that triggers are attached to must be created with [createUserPool], whose lambdaConfig waits until the
+// program has registered all of its triggers and then merges them with any given when the pool was created.
+const userPoolInfos = new Map<aws.cognito.UserPool, UserPoolInfo>();
+
+process.on("beforeExit", resolveLambdaConfigs);
+
+function resolveLambdaConfigs() {
+    for (const info of userPoolInfos.values()) {
+        if (!info.resolved) {
+            info.resolved = true;
+            info.resolve(info.triggers);
+        }
+    }
+}
+
+/**
+ * Creates a new user pool that triggers can be attached to with [onTrigger] and its convenience wrappers.  Any
+ * triggers in [args.lambdaConfig] are kept, but may not also be attached with [onTrigger].
+ */
+export function createUserPool(
+    name: string, args?: aws.cognito.UserPoolArgs, opts?: pulumi.ResourceOptions): aws.cognito.UserPool {
+
+    args = args || {};
+
+    let resolve!: (triggers: Record<string, pulumi.Output<string>>) => void;
+    const triggers = pulumi.output(new Promise<Record<string, pulumi.Output<string>>>(r => resolve = r));
+
+    const lambdaConfig = pulumi.all([args.lambdaConfig, triggers]).apply(([existing, added]) => {
+        const merged: Record<string, any> = { ...existing };
+        for (const trigger of Object.keys(added)) {
+            if (merged[trigger] !== undefined) {
+                throw new Error(`User pool '${name}' already has a '${trigger}' trigger in its lambdaConfig.`);
+            }
+            merged[trigger] = added[trigger];
+        }
+        return merged;
+    });
+
+    const userPool = new aws.cognito.UserPool(name, { ...args, lambdaConfig: lambdaConfig }, opts);
+    userPoolInfos.set(userPool, { name: name, triggers: {}, resolve: resolve, resolved: false });
+    return userPool;
+}
+
+/**
+ * Creates a new subscription that invokes the handler provided for the given trigger of the user pool, which must
+ * have been created with [createUserPool].
+ */
+export function onTrigger(
+    name: string, userPool: aws.cognito.UserPool, trigger: TriggerName, handler: TriggerEventHandler,
+    args?: TriggerArgs, opts?: pulumi.ComponentResourceOptions): TriggerEventSubscription {
+
+    return new TriggerEventSubscription(name, userPool, trigger, handler, args, opts);
+}
+
+/**
+ * Creates a new subscription that invokes the handler provided before a user is signed up to the user pool.
+ */
+export function onPreSignUp(
+    name: string, userPool: aws.cognito.UserPool, handler: TriggerEventHandler,
+    args?: TriggerArgs, opts?: pulumi.ComponentResourceOptions): TriggerEventSubscription {
+
+    return onTrigger(name, userPool, "preSignUp", handler, args, opts);
+}
+
+/**
+ * Creates a new subscription that invokes the handler provided after a user of the user pool confirms their account.
+ */
+export function onPostConfirmation(
+    name: string, userPool: aws.cognito.UserPool, handler: TriggerEventHandler,
+    args?: TriggerArgs, opts?: pulumi.ComponentResourceOptions): TriggerEventSubscription {
+
+    return onTrigger(name, userPool, "postConfirmation", handler, args, opts);
+}
+
+/**
+ * Creates a new subscription that invokes the handler provided before the user pool issues tokens, allowing their
+ * claims to be customized.
+ */
+export function onPreTokenGeneration(
+    name: string, userPool: aws.cognito.UserPool, handler: TriggerEventHandler,
+    args?: TriggerArgs, opts?: pulumi.ComponentResourceOptions): TriggerEventSubscription {
+
+    return onTrigger(name, userPool, "preTokenGeneration", handler, args, opts);
+}
+
+export class TriggerEventSubscription extends EventSubscription {
+    public readonly userPool: aws.cognito.UserPool;
+    public readonly trigger: TriggerName;
+
+    public constructor(
+        name: string, userPool: aws.cognito.UserPool, trigger: TriggerName, handler: TriggerEventHandler,
+        args?: TriggerArgs, opts?: pulumi.ComponentResourceOptions) {
+
+        super("aws-serverless:cognito:TriggerEventSubscription", name, { userPool: userPool }, opts);
+
+        const info = userPoolInfos.get(userPool);
+        if (!info) {
+            throw new Error(
+                `Subscription '${name}' must be attached to a user pool created with cognito.createUserPool.`);
+        }
+        if (info.resolved) {
+            throw new Error(
+                `Subscription '${name}' was added to user pool '${info.name}' after its lambdaConfig was resolved.`);
+        }
+        if (info.triggers[trigger] !== undefined) {
+            throw new Error(`User pool '${info.name}' already has a '${trigger}' trigger.`);
+        }
+
+        args = args || {};
+
+        this.userPool = userPool;
+        this.trigger = trigger;
+        const { func, role, functionUrl, targetArn } = createFunction(
+            name + "-trigger-subscription", { subscription: name, source: "Cognito" },
+            handler, args, childOptions(this, opts));
+        this.func = func;
+        this.role = role;
+        this.functionUrl = functionUrl && functionUrl.functionUrl;
+
+        this.permission = new aws.lambda.Permission(name, {
+            function: targetArn,
+            action: "lambda:InvokeFunction",
+            principal: "cognito-idp.amazonaws.com",
+            sourceArn: userPool.arn,
+        }, childOptions(this, opts));
+
+        info.triggers[trigger] = targetArn;
+
+        this.registerOutputs();
+    }
+}
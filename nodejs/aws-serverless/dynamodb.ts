@@ -0,0 +1,173 @@
+// Copyright 2016-2018, Pulumi Corporation.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+import * as aws from "@pulumi/aws";
+import * as pulumi from "@pulumi/pulumi";
+
+import { createFunction, FunctionArgs, grantDelivery, grantSourceRead, Handler } from "./function";
+import {
+    BatchItemFailuresResponse, checkBatchingWindow, checkBatchSize, checkMaximumRecordAge, checkMaximumRetryAttempts,
+    checkTumblingWindow, EventSubscription, FilterCriteria, functionResponseTypes, maxStreamBatchSize,
+    serializeFilterCriteria, StreamRetryArgs, TumblingWindowEventFields, TumblingWindowResponse,
+} from "./subscription";
+import { childOptions, mergeTags } from "./utils";
+
+export interface TableEvent {
+    Records: TableEventRecord[];
+}
+
+/** An alias for [TableEvent], matching the name AWS uses for this event. */
+export type DynamoDBStreamEvent = TableEvent;
+
+export interface TableEventRecord {
+    awsRegion: string;
+    dynamodb: {
+        ApproximateCreationDateTime: number;
+        Keys: Record<string, any>;
+        NewImage?: Record<string, any>;
+        OldImage?: Record<string, any>;
+        SequenceNumber: string;
+        SizeBytes: number;
+        StreamViewType: "KEYS_ONLY" | "NEW_IMAGE" | "OLD_IMAGE" | "NEW_AND_OLD_IMAGES";
+    };
+    eventID: string;
+    eventName: "INSERT" | "MODIFY" | "REMOVE";
+    eventSource: string;
+    eventSourceARN: string;
+    eventVersion: string;
+}
+
+export type TableEventHandler = Handler<TableEvent, void | BatchItemFailuresResponse>;
+
+/**
+ * The event passed to the handler of a subscription with [tumblingWindowInSeconds] set.
+ */
+export interface TableWindowEvent extends TableEvent, TumblingWindowEventFields {
+}
+
+export type TableWindowEventHandler = Handler<TableWindowEvent, TumblingWindowResponse>;
+
+// AnyTableEventHandler covers handlers both with and without a tumbling window, so that either can be passed to
+// createFunction.
+type AnyTableEventHandler = Handler<TableEvent, void | BatchItemFailuresResponse | TumblingWindowResponse>;
+
+export interface TableSubscriptionArgs extends FunctionArgs, StreamRetryArgs {
+    /**
+     * The largest number of records that Lambda will retrieve from your event source at the time of invocation.
+     * Defaults to 100, and may be up to 10000.
+     */
+    batchSize?: pulumi.Input<number>;
+
+    /**
+     * The maximum amount of time, in seconds, Lambda spends gathering records before invoking the function.
+     */
+    maximumBatchingWindowInSeconds?: pulumi.Input<number>;
+
+    /**
+     * Only invoke the function for records matching one of the given filters.
+     */
+    filterCriteria?: pulumi.Input<FilterCriteria>;
+
+    /**
+     * Whether the handler reports which records in a batch failed by returning a [BatchItemFailuresResponse], rather
+     * than the whole batch being retried whenever it throws.
+     */
+    reportBatchItemFailures?: pulumi.Input<boolean>;
+
+    /**
+     * Groups records into consecutive windows of the given number of seconds, between 0 and 900, passing state from
+     * one invocation to the next within each window.  The handler should then be a [TableWindowEventHandler].
+     */
+    tumblingWindowInSeconds?: pulumi.Input<number>;
+
+    /**
+     * Where in the stream the subscription starts reading when it is first created: from the oldest record still
+     * retained ("TRIM_HORIZON"), or from new records only ("LATEST").  Defaults to "LATEST".  Unlike Kinesis,
+     * DynamoDB streams cannot be read from a timestamp.
+     */
+    startingPosition?: "TRIM_HORIZON" | "LATEST";
+}
+
+/**
+ * Creates a new subscription to the given table's stream using the handler provided, along with optional options to
+ * control the behavior of the subscription.  The table must have streams enabled (see
+ * aws.dynamodb.Table.streamEnabled).
+ */
+export function subscribe(
+    name: string, table: aws.dynamodb.Table, handler: TableEventHandler | TableWindowEventHandler,
+    args?: TableSubscriptionArgs, opts?: pulumi.ComponentResourceOptions): TableEventSubscription {
+
+    return new TableEventSubscription(name, table, handler, args, opts);
+}
+
+export class TableEventSubscription extends EventSubscription {
+    public readonly table: aws.dynamodb.Table;
+    public readonly eventSourceMapping: aws.lambda.EventSourceMapping;
+
+    public constructor(
+        name: string, table: aws.dynamodb.Table, handler: TableEventHandler | TableWindowEventHandler,
+        args?: TableSubscriptionArgs, opts?: pulumi.ComponentResourceOptions) {
+
+        super("aws-serverless:dynamodb:TableEventSubscription", name, { table: table }, opts);
+
+        args = args || {};
+        const tumblingWindow = checkTumblingWindow(name, args.tumblingWindowInSeconds);
+        const batchSize = checkBatchSize(name, "DynamoDB streams", args.batchSize, maxStreamBatchSize);
+        const batchingWindow = checkBatchingWindow(name, args.maximumBatchingWindowInSeconds);
+        const retryAttempts = checkMaximumRetryAttempts(name, args.maximumRetryAttempts);
+        const recordAge = checkMaximumRecordAge(name, args.maximumRecordAgeInSeconds);
+
+        this.table = table;
+        const { func, role, functionUrl, targetArn } = createFunction(
+            name + "-table-subscription", { subscription: name, source: "DynamoDB stream" },
+            <AnyTableEventHandler>handler, args, childOptions(this, opts));
+        this.func = func;
+        this.role = role;
+        this.functionUrl = functionUrl && functionUrl.functionUrl;
+
+        if (role && args.discardedBatchDestination !== undefined) {
+            grantDelivery(name + "-discarded-batch", role, pulumi.output(args.discardedBatchDestination),
+                ["sqs", "sns"], childOptions(this, opts));
+        }
+
+        // A role only allowed to write its function's logs must also be allowed to read the table's stream for the
+        // mapping to poll it.
+        const mappingDependencies: pulumi.Resource[] = [];
+        if (role && args.leastPrivilegeLogging) {
+            mappingDependencies.push(grantSourceRead(name + "-read", role, table.streamArn, [
+                "dynamodb:DescribeStream", "dynamodb:GetRecords", "dynamodb:GetShardIterator",
+            ], childOptions(this, opts)));
+        }
+
+        this.eventSourceMapping = new aws.lambda.EventSourceMapping(name, {
+            eventSourceArn: table.streamArn,
+            functionName: targetArn,
+            startingPosition: args.startingPosition || "LATEST",
+            batchSize: batchSize,
+            maximumBatchingWindowInSeconds: batchingWindow,
+            filterCriteria: args.filterCriteria === undefined
+                ? undefined : serializeFilterCriteria(args.filterCriteria),
+            maximumRetryAttempts: retryAttempts,
+            maximumRecordAgeInSeconds: recordAge,
+            bisectBatchOnFunctionError: args.bisectBatchOnFunctionError,
+            destinationConfig: args.discardedBatchDestination === undefined
+                ? undefined : { onFailure: { destinationArn: args.discardedBatchDestination } },
+            functionResponseTypes: functionResponseTypes(args.reportBatchItemFailures),
+            tumblingWindowInSeconds: tumblingWindow,
+            tags: mergeTags(args.tags),
+        }, childOptions(this, opts, mappingDependencies));
+
+        this.registerOutputs();
+    }
+}
@@ -43,7 +43,19 @@ const lambda = new aws.lambda.Function("myfunction", {
     runtime: aws.lambda.NodeJS8d10Runtime,
 });
 
+// A custom domain is only configured when the stack is given a certificate for it.
+const config = new pulumi.Config();
+const domainName = config.get("domainName");
+const certificateArn = config.get("certificateArn");
+
+// Requests are logged for auditing, and traced to find slow routes.  This is the only API in the program, so it also
+// gives API Gateway the role it needs to write logs in this region.
+const accessLogs = new aws.cloudwatch.LogGroup("myapi-access", { retentionInDays: 30 });
+
 const api = new serverless.apigateway.API("myapi", {
+    stageName: "prod",
+    accessLog: { destinationArn: accessLogs.arn, configureAccount: true },
+    xrayTracingEnabled: true,
     routes: [
         { method: "GET", path: "/a", handler: async (event) => {
             return {
@@ -52,7 +64,56 @@ const api = new serverless.apigateway.API("myapi", {
             };
         }},
         { method: "GET", path: "/b", handler: lambda },
+        { method: "GET", path: "/private", apiKeyRequired: true, handler: async (event) => {
+            return {
+                statusCode: 200,
+                body: "<h1>Hello partner!</h1>",
+            };
+        }},
+        {
+            method: "POST",
+            path: "/items",
+            requestSchema: {
+                type: "object",
+                properties: {
+                    name: { type: "string" },
+                },
+                required: ["name"],
+            },
+            handler: async (event) => {
+                return {
+                    statusCode: 201,
+                    body: event.body,
+                };
+            },
+        },
     ],
+    cors: {
+        allowOrigins: ["https://example.com"],
+        allowMethods: ["GET"],
+        allowHeaders: ["Content-Type"],
+        maxAge: 600,
+    },
+    binaryMediaTypes: ["image/png", "application/x-protobuf"],
+    usagePlan: {
+        throttle: {
+            rateLimit: 10,
+            burstLimit: 20,
+        },
+        quota: {
+            limit: 1000,
+            period: "DAY",
+        },
+        apiKeys: ["partner"],
+    },
+    domain: domainName && certificateArn ? {
+        domainName: domainName,
+        certificateArn: certificateArn,
+        basePath: "v1",
+        endpointType: "REGIONAL",
+    } : undefined,
 });
 
 export const url = api.url;
+export const domainTarget = api.domainTarget;
+export const accessLogGroupArn = accessLogs.arn;
@@ -0,0 +1,5 @@
+exports.handler = async (event) => {
+    for (const record of event.Records || []) {
+        console.log(`Received: ${record.Sns.Message}`);
+    }
+};
@@ -0,0 +1,43 @@
+// Copyright 2016-2018, Pulumi Corporation.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+
+import * as aws from "@pulumi/aws";
+import * as serverless from "@pulumi/aws-serverless";
+import * as pulumi from "@pulumi/pulumi";
+
+const topic = new aws.sns.Topic("messages");
+
+// The handler's code is checked in already built, rather than serialized from a callback.
+const func = serverless.fromAsset("log-message", {
+    code: new pulumi.asset.FileArchive("./handler"),
+    handler: "index.handler",
+    runtime: "nodejs20.x",
+}, {
+    memorySize: 256,
+    // Named explicitly so other stacks can refer to the function.  Including the stack keeps the names unique.
+    functionName: `log-message-${pulumi.getStack()}`,
+    roleName: `log-message-${pulumi.getStack()}`,
+});
+
+serverless.topic.subscribe("log-message", topic, func);
+
+// Compiled handlers run on a custom runtime, which starts the archive's "bootstrap" executable.
+const stream = new aws.kinesis.Stream("records", { shardCount: 1 });
+const recordsFunc = serverless.fromAsset("log-records", {
+    code: new pulumi.asset.FileArchive("./bootstrap"),
+    runtime: "provided.al2",
+});
+
+serverless.kinesis.subscribe("log-records", stream, recordsFunc, { batchSize: 10 });
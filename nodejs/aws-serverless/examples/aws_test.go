@@ -15,16 +15,20 @@
 package examples
 
 import (
+	"bytes"
+	"encoding/json"
 	"fmt"
 	"io/ioutil"
 	"net/http"
 	"os"
 	"path"
+	"strings"
 	"testing"
 	"time"
 
 	"github.com/stretchr/testify/assert"
 
+	"github.com/pulumi/pulumi/pkg/apitype"
 	"github.com/pulumi/pulumi/pkg/testing/integration"
 )
 
@@ -39,54 +43,1031 @@ func Test_Examples(t *testing.T) {
 	if !assert.NoError(t, err, "expected a valid working directory: %v", err) {
 		return
 	}
-	examples := []integration.ProgramTestOptions{
-		{
-			Dir: path.Join(cwd, "./bucket"),
-			Config: map[string]string{
-				"aws:region": region,
+	// The custom domain in the api example needs a real certificate, so it is only exercised when one is provided.
+	apiConfig := map[string]string{}
+	apiDomainName := os.Getenv("API_DOMAIN_NAME")
+	if apiDomainName != "" {
+		apiConfig["domainName"] = apiDomainName
+		apiConfig["certificateArn"] = os.Getenv("API_CERTIFICATE_ARN")
+	}
+
+	// The output of the bucket example is checked for the warnings raised by its subscriptions, and that of its
+	// failing update for the subscriptions found to overlap.
+	var bucketOutput, bucketOverlapOutput bytes.Buffer
+	// The output of the topic example's failing update is checked for the subscription it was reported against.
+	var topicOutput bytes.Buffer
+	// As is the output of the failing updates rejecting batch sizes and batching windows their sources don't support.
+	var kinesisOutput, kinesisWindowOutput, queueOutput bytes.Buffer
+	// And that of the failing update rejecting retry limits Lambda doesn't support.
+	var dynamodbOutput bytes.Buffer
+	// The cloudwatch example's launch announcement is scheduled shortly after the example starts, so that it has fired
+	// by the time the example is deployed again, whose output is checked for the warning about it.
+	var announcementAt time.Time
+	var cloudwatchOutput bytes.Buffer
+	// The output of the function example's failing update is checked for the dead-letter target it rejected.
+	var functionOutput bytes.Buffer
+
+	examples := []exampleTest{
+		{dir: "bucket", options: integration.ProgramTestOptions{
+			Stdout: &bucketOutput,
+			ExtraRuntimeValidation: func(t *testing.T, stack integration.RuntimeValidationStackInfo) {
+				// Only the subscription whose skipped objects overlap its trigger filter should warn.
+				assert.Contains(t, bucketOutput.String(), "Subscription 'thumbnails' is triggered by objects it writes")
+				assert.NotContains(t, bucketOutput.String(), "Subscription 'test' is triggered by objects it writes")
+
+				// All three subscriptions should be merged into the bucket's single notification.
+				notifications := resourcesOfType(stack, "aws:s3/bucketNotification:BucketNotification")
+				if !assert.Len(t, notifications, 1) {
+					return
+				}
+				assert.Len(t, notifications[0].Outputs["lambdaFunctions"], 3)
+				validateBucketNotification(t, stack, notifications[0], "uploads/")
+
+				// Every function runs on the default architecture, other than the thumbnailer which overrides it.
+				var storageSizes []interface{}
+				for _, function := range resourcesOfType(stack, "aws:lambda/function:Function") {
+					assert.Equal(t, "nodejs20.x", function.Outputs["runtime"])
+					storage := function.Outputs["ephemeralStorage"].(map[string]interface{})
+					storageSizes = append(storageSizes, storage["size"])
+					architecture := "arm64"
+					if storage["size"] == float64(2048) {
+						architecture = "x86_64"
+					}
+					assert.Equal(t, []interface{}{architecture}, function.Outputs["architectures"])
+				}
+				assert.ElementsMatch(t, []interface{}{float64(512), float64(512), float64(2048)}, storageSizes)
+
+				// Functions take the default timeout unless they override it, and Lambda's default memory size unless
+				// they set their own.
+				limits := map[string]struct{ memorySize, timeout float64 }{
+					"test-bucket-subscription":       {memorySize: 256, timeout: 30},
+					"thumbnails-bucket-subscription": {memorySize: 128, timeout: 60},
+					"removed-bucket-subscription":    {memorySize: 128, timeout: 30},
+				}
+				for functionName, limit := range limits {
+					if fn, ok := resourceNamed(t, stack, "aws:lambda/function:Function", functionName); ok {
+						assert.Equal(t, limit.memorySize, fn.Outputs["memorySize"], "memorySize of %v", functionName)
+						assert.Equal(t, limit.timeout, fn.Outputs["timeout"], "timeout of %v", functionName)
+					}
+				}
+
+				// The test handler reads the name of its record file from its environment.
+				if fn, ok := resourceNamed(t, stack, "aws:lambda/function:Function", "test-bucket-subscription"); ok {
+					assert.Equal(t, map[string]interface{}{
+						"variables": map[string]interface{}{"RECORD_FILE": "lastPutFile.json"},
+					}, fn.Outputs["environment"])
+				}
+
+				// The removal handler's factory is serialized along with the bucket name it was given.
+				var bucketName interface{}
+				for _, bucket := range resourcesOfType(stack, "aws:s3/bucket:Bucket") {
+					bucketName = bucket.Outputs["id"]
+				}
+				var removedCode []string
+				for _, function := range resourcesOfType(stack, "aws:lambda/function:Function") {
+					if strings.Contains(string(function.URN), "::removed-bucket-subscription") {
+						code, err := json.Marshal(function.Inputs["code"])
+						if assert.NoError(t, err) {
+							removedCode = append(removedCode, string(code))
+						}
+					}
+				}
+				if assert.Len(t, removedCode, 1) && assert.IsType(t, "", bucketName) {
+					assert.Contains(t, removedCode[0], bucketName.(string))
+				}
+
+				// The handlers read the records of the bucket's events as typed.
+				assertHandlerReads(t, stack, "test-bucket-subscription", "s3.object.size", "eventTime")
+				assertHandlerReads(t, stack, "thumbnails-bucket-subscription", "s3.bucket.arn")
 			},
-			Dependencies: []string{
-				"@pulumi/aws-serverless",
+			EditDirs: []integration.EditDir{
+				{
+					Dir:           "./bucket/step2",
+					ExpectFailure: true,
+				},
+				{
+					Dir:           "./bucket/step3",
+					ExpectFailure: true,
+				},
+				{
+					Dir: "./bucket/step4",
+					ExtraRuntimeValidation: func(t *testing.T, stack integration.RuntimeValidationStackInfo) {
+						notifications := resourcesOfType(stack, "aws:s3/bucketNotification:BucketNotification")
+						if assert.Len(t, notifications, 1) {
+							validateBucketNotification(t, stack, notifications[0], "incoming/")
+						}
+					},
+				},
+				{
+					Dir:           "./bucket/step5",
+					Stdout:        &bucketOverlapOutput,
+					ExpectFailure: true,
+				},
+				{
+					// Restore the previous program, checking the failed update named both subscriptions.
+					Dir: "./bucket/step4",
+					ExtraRuntimeValidation: func(t *testing.T, stack integration.RuntimeValidationStackInfo) {
+						assert.Contains(t, bucketOverlapOutput.String(),
+							"Subscriptions 'images' and 'raw-images' on bucket")
+						assert.Contains(t, bucketOverlapOutput.String(),
+							"have overlapping events and prefix/suffix filters")
+					},
+				},
 			},
-		},
-		{
-			Dir: path.Join(cwd, "./cloudwatch"),
-			Config: map[string]string{
-				"aws:region": region,
+		}},
+		{dir: "cloudfront", options: integration.ProgramTestOptions{
+			ExtraRuntimeValidation: func(t *testing.T, stack integration.RuntimeValidationStackInfo) {
+				functions := resourcesOfType(stack, "aws:lambda/function:Function")
+				if !assert.Len(t, functions, 1) {
+					return
+				}
+				// Lambda@Edge only runs published versions, so the returned ARN must name one.
+				assert.NotEqual(t, "$LATEST", functions[0].Outputs["version"])
+				assert.Equal(t, functions[0].Outputs["qualifiedArn"], stack.Outputs["rewriteArn"])
+				assert.True(t, strings.HasPrefix(stack.Outputs["rewriteArn"].(string), "arn:aws:lambda:us-east-1:"))
+				assert.Empty(t, functions[0].Outputs["environment"])
+
+				roles := resourcesOfType(stack, "aws:iam/role:Role")
+				if assert.Len(t, roles, 1) {
+					assert.Contains(t, roles[0].Outputs["assumeRolePolicy"], "lambda.amazonaws.com")
+					assert.Contains(t, roles[0].Outputs["assumeRolePolicy"], "edgelambda.amazonaws.com")
+				}
 			},
-			Dependencies: []string{
-				"@pulumi/aws-serverless",
+		}},
+		{dir: "cloudwatch", config: func() map[string]string {
+			announcementAt = time.Now().Add(5 * time.Minute).UTC().Truncate(time.Second)
+			return map[string]string{"announcementAt": announcementAt.Format(time.RFC3339)}
+		}, options: integration.ProgramTestOptions{
+			Stdout: &cloudwatchOutput,
+			ExtraRuntimeValidation: func(t *testing.T, stack integration.RuntimeValidationStackInfo) {
+				schedules := map[interface{}]apitype.ResourceV2{}
+				for _, schedule := range resourcesOfType(stack, "aws:scheduler/schedule:Schedule") {
+					schedules[schedule.Outputs["scheduleExpression"]] = schedule
+				}
+				if !assert.Len(t, schedules, 3) {
+					return
+				}
+				// The launch announcement is scheduled at the time it was configured with, in UTC.
+				_, has := schedules["at("+announcementAt.Format("2006-01-02T15:04:05")+")"]
+				assert.True(t, has)
+				morning, has := schedules["cron(0 9 ? * MON-FRI *)"]
+				if assert.True(t, has) {
+					assert.Equal(t, "America/New_York", morning.Outputs["scheduleExpressionTimezone"])
+				}
+				reminder, has := schedules["at(2035-01-01T09:00:00)"]
+				if assert.True(t, has) {
+					assert.Equal(t, "OFF", reminder.Outputs["flexibleTimeWindow"].(map[string]interface{})["mode"])
+				}
+
+				// Each schedule invokes its function through a role of its own.
+				var schedulerRoles int
+				for _, role := range resourcesOfType(stack, "aws:iam/role:Role") {
+					if strings.Contains(role.Outputs["assumeRolePolicy"].(string), "scheduler.amazonaws.com") {
+						schedulerRoles++
+					}
+				}
+				assert.Equal(t, 3, schedulerRoles)
+
+				urls := resourcesOfType(stack, "aws:lambda/functionUrl:FunctionUrl")
+				if assert.Len(t, urls, 1) {
+					assert.Equal(t, "NONE", urls[0].Outputs["authorizationType"])
+					assert.Equal(t, urls[0].Outputs["functionUrl"], stack.Outputs["morningReportUrl"])
+				}
+				var urlPermissions int
+				for _, permission := range resourcesOfType(stack, "aws:lambda/permission:Permission") {
+					if permission.Outputs["functionUrlAuthType"] == "NONE" {
+						urlPermissions++
+					}
+				}
+				assert.Equal(t, 1, urlPermissions)
+
+				// Every resource created for the subscription given a provider uses it, from the function down.
+				var providerURN string
+				for _, provider := range resourcesOfType(stack, "pulumi:providers:aws") {
+					if strings.HasSuffix(string(provider.URN), "::events") {
+						providerURN = string(provider.URN)
+					}
+				}
+				if !assert.NotEmpty(t, providerURN) {
+					return
+				}
+				var providedTypes []string
+				for _, res := range stack.Deployment.Resources {
+					if res.Custom && strings.Contains(string(res.URN), "ec2-state-change") {
+						assert.True(t, strings.HasPrefix(res.Provider, providerURN+"::"), "%v uses %v", res.URN, res.Provider)
+						providedTypes = append(providedTypes, string(res.Type))
+					}
+				}
+				assert.Contains(t, providedTypes, "aws:lambda/function:Function")
+				assert.Contains(t, providedTypes, "aws:lambda/permission:Permission")
+
+				// The state change rule matches events by their pattern, rather than running on a schedule.
+				if rule, ok := resourceNamed(t, stack, "aws:cloudwatch/eventRule:EventRule", "ec2-state-change"); ok {
+					assert.JSONEq(t, `{"source":["aws.ec2"],"detail-type":["EC2 Instance State-change Notification"]}`,
+						rule.Outputs["eventPattern"].(string))
+					assert.Empty(t, rule.Outputs["scheduleExpression"])
+				}
+
+				// The application's errors are delivered to their handler once CloudWatch Logs may invoke it.
+				fn, fnOK := resourceNamed(t, stack, "aws:lambda/function:Function", "app-errors-log-subscription")
+				permission, permissionOK := resourceNamed(t, stack, "aws:lambda/permission:Permission", "app-errors")
+				if permissionOK {
+					assert.Equal(t, "logs.amazonaws.com", permission.Outputs["principal"])
+					assert.Equal(t, strings.TrimSuffix(stack.Outputs["appLogGroupArn"].(string), ":*")+":*",
+						permission.Outputs["sourceArn"])
+				}
+				filter, filterOK := resourceNamed(t, stack,
+					"aws:cloudwatch/logSubscriptionFilter:LogSubscriptionFilter", "app-errors")
+				if filterOK && fnOK && permissionOK {
+					assert.Equal(t, stack.Outputs["appLogGroupName"], filter.Outputs["logGroup"])
+					assert.Equal(t, "ERROR", filter.Outputs["filterPattern"])
+					assert.Equal(t, fn.Outputs["arn"], filter.Outputs["destinationArn"])
+					assert.Contains(t, filter.Dependencies, permission.URN)
+				}
+
+				// The handlers read the events they're given as typed.
+				assertHandlerReads(t, stack, "process-topic-topic-subscription", "Sns.Message")
+				assertHandlerReads(t, stack, "ec2-state-change-event-subscription", "resources.join", "detail.state")
+				assertHandlerReads(t, stack, "app-errors-log-subscription", "awslogs.data", "logEvents")
+
+				// Wait for the launch announcement to fire before the program is deployed again.
+				time.Sleep(time.Until(announcementAt.Add(time.Minute)))
 			},
-		},
-		{
-			Dir: path.Join(cwd, "./topic"),
-			Config: map[string]string{
-				"aws:region": region,
+			EditDirs: []integration.EditDir{
+				{
+					// Deploying the program again once its one-time schedule has fired succeeds, warning about the
+					// schedule rather than rejecting it.
+					Dir: "./cloudwatch/step2",
+					ExtraRuntimeValidation: func(t *testing.T, stack integration.RuntimeValidationStackInfo) {
+						assert.Contains(t, cloudwatchOutput.String(), fmt.Sprintf(
+							"Subscription 'launch-announcement' is scheduled at %v, which has already passed.",
+							announcementAt.Format("2006-01-02T15:04:05.000Z")))
+						assert.Len(t, resourcesOfType(stack, "aws:scheduler/schedule:Schedule"), 3)
+					},
+				},
 			},
-			Dependencies: []string{
-				"@pulumi/aws-serverless",
+		}},
+		{dir: "cognito", options: integration.ProgramTestOptions{
+			ExtraRuntimeValidation: func(t *testing.T, stack integration.RuntimeValidationStackInfo) {
+				functions := resourcesOfType(stack, "aws:lambda/function:Function")
+				assert.Len(t, functions, 2)
+				permissions := resourcesOfType(stack, "aws:lambda/permission:Permission")
+				if assert.Len(t, permissions, 2) {
+					for _, permission := range permissions {
+						assert.Equal(t, "cognito-idp.amazonaws.com", permission.Outputs["principal"])
+					}
+				}
+
+				// Both triggers should be merged into the pool's single lambdaConfig.
+				pools := resourcesOfType(stack, "aws:cognito/userPool:UserPool")
+				if !assert.Len(t, pools, 1) {
+					return
+				}
+				config := pools[0].Outputs["lambdaConfig"].(map[string]interface{})
+				var arns []interface{}
+				for _, function := range functions {
+					arns = append(arns, function.Outputs["arn"])
+				}
+				assert.ElementsMatch(t, arns, []interface{}{config["preSignUp"], config["postConfirmation"]})
 			},
-		},
-		{
-			Dir: path.Join(cwd, "./queue"),
-			Config: map[string]string{
-				"aws:region": region,
+		}},
+		{dir: "kinesis", options: integration.ProgramTestOptions{
+			ExtraRuntimeValidation: func(t *testing.T, stack integration.RuntimeValidationStackInfo) {
+				consumers := resourcesOfType(stack, "aws:kinesis/streamConsumer:StreamConsumer")
+				if !assert.Len(t, consumers, 1) {
+					return
+				}
+				mappings := resourcesOfType(stack, "aws:lambda/eventSourceMapping:EventSourceMapping")
+				var fanOutMappings, windowMappings int
+				for _, mapping := range mappings {
+					if mapping.Outputs["eventSourceArn"] == consumers[0].Outputs["arn"] {
+						assert.Equal(t, "TRIM_HORIZON", mapping.Outputs["startingPosition"])
+						assert.Equal(t, float64(5), mapping.Outputs["maximumBatchingWindowInSeconds"])
+						fanOutMappings++
+					}
+					if mapping.Outputs["tumblingWindowInSeconds"] == float64(60) {
+						assert.Equal(t, "LATEST", mapping.Outputs["startingPosition"])
+						windowMappings++
+					}
+				}
+				assert.Equal(t, 1, fanOutMappings)
+				assert.Equal(t, 1, windowMappings)
+
+				var fanOutActions []string
+				for _, policy := range resourcesOfType(stack, "aws:iam/rolePolicy:RolePolicy") {
+					var document struct {
+						Statement []struct {
+							Action   interface{} `json:"Action"`
+							Resource string      `json:"Resource"`
+						} `json:"Statement"`
+					}
+					if !assert.NoError(t, json.Unmarshal([]byte(policy.Outputs["policy"].(string)), &document)) {
+						continue
+					}
+					for _, statement := range document.Statement {
+						if statement.Resource != consumers[0].Outputs["arn"] {
+							continue
+						}
+						for _, action := range statement.Action.([]interface{}) {
+							fanOutActions = append(fanOutActions, action.(string))
+						}
+					}
+				}
+				assert.Contains(t, fanOutActions, "kinesis:SubscribeToShard")
+
+				assertHandlerReads(t, stack, "count-clicks-stream-subscription", "kinesis.data")
+				assertHandlerReads(t, stack, "clicks-per-minute-stream-subscription", "isFinalInvokeForWindow", "window.start")
 			},
-			Dependencies: []string{
-				"@pulumi/aws-serverless",
+			EditDirs: []integration.EditDir{
+				{
+					Dir:           "./kinesis/step2",
+					ExpectFailure: true,
+				},
+				{
+					Dir:           "./kinesis/step3",
+					ExpectFailure: true,
+				},
+				{
+					Dir:           "./kinesis/step4",
+					Stdout:        &kinesisOutput,
+					ExpectFailure: true,
+				},
+				{
+					Dir:           "./kinesis/step5",
+					Stdout:        &kinesisWindowOutput,
+					ExpectFailure: true,
+				},
+				{
+					Dir: "./kinesis",
+					ExtraRuntimeValidation: func(t *testing.T, stack integration.RuntimeValidationStackInfo) {
+						assert.Contains(t, kinesisOutput.String(),
+							"Subscription 'clicks' has a batchSize of 20000, but Kinesis only supports values between 1 and 10000.")
+						assert.Contains(t, kinesisWindowOutput.String(),
+							"Subscription 'clicks' has a maximumBatchingWindowInSeconds of 600, "+
+								"but Lambda only supports values between 0 and 300.")
+					},
+				},
 			},
-		},
-		{
-			Dir: path.Join(cwd, "./api"),
-			Config: map[string]string{
-				"aws:region": region,
+		}},
+		{dir: "dynamodb", options: integration.ProgramTestOptions{
+			ExtraRuntimeValidation: func(t *testing.T, stack integration.RuntimeValidationStackInfo) {
+				tables := resourcesOfType(stack, "aws:dynamodb/table:Table")
+				if !assert.Len(t, tables, 1) {
+					return
+				}
+				mappings := resourcesOfType(stack, "aws:lambda/eventSourceMapping:EventSourceMapping")
+				if !assert.Len(t, mappings, 1) {
+					return
+				}
+				mapping := mappings[0]
+				assert.Equal(t, stack.Outputs["subscriptionMappingUuid"], mapping.Outputs["uuid"])
+				assert.Equal(t, tables[0].Outputs["streamArn"], mapping.Outputs["eventSourceArn"])
+				assert.Equal(t, "TRIM_HORIZON", mapping.Outputs["startingPosition"])
+				assert.Equal(t, float64(10), mapping.Outputs["maximumBatchingWindowInSeconds"])
+				assert.Equal(t, map[string]interface{}{
+					"filters": []interface{}{map[string]interface{}{"pattern": `{"eventName":["INSERT"]}`}},
+				}, mapping.Outputs["filterCriteria"])
+
+				// Failing batches are split and retried a limited number of times, then sent to the queue of failed
+				// orders, which the function's role may deliver to.
+				assert.Equal(t, float64(3), mapping.Outputs["maximumRetryAttempts"])
+				assert.Equal(t, float64(3600), mapping.Outputs["maximumRecordAgeInSeconds"])
+				assert.Equal(t, true, mapping.Outputs["bisectBatchOnFunctionError"])
+				assert.Equal(t, []interface{}{"ReportBatchItemFailures"}, mapping.Outputs["functionResponseTypes"])
+				assert.Equal(t, map[string]interface{}{
+					"onFailure": map[string]interface{}{"destinationArn": stack.Outputs["failedOrdersArn"]},
+				}, mapping.Outputs["destinationConfig"])
+				if policy, ok := resourceNamed(t, stack, "aws:iam/rolePolicy:RolePolicy", "process-orders-discarded-batch"); ok {
+					assert.Contains(t, policy.Outputs["policy"], "sqs:SendMessage")
+					assert.Contains(t, policy.Outputs["policy"], stack.Outputs["failedOrdersArn"])
+				}
+
+				assertHandlerReads(t, stack, "process-orders-table-subscription",
+					"dynamodb.NewImage", "dynamodb.SequenceNumber", "dynamodb.Keys")
+			},
+			EditDirs: []integration.EditDir{
+				{
+					Dir:           "./dynamodb/step2",
+					Stdout:        &dynamodbOutput,
+					ExpectFailure: true,
+				},
+				{
+					Dir: "./dynamodb",
+					ExtraRuntimeValidation: func(t *testing.T, stack integration.RuntimeValidationStackInfo) {
+						assert.Contains(t, dynamodbOutput.String(),
+							"Subscription 'process-orders' has a maximumRetryAttempts of 20000, "+
+								"but Lambda only supports values between -1 (retry until the records expire) and 10000.")
+					},
+				},
+			},
+		}},
+		{dir: "ses", options: integration.ProgramTestOptions{
+			ExtraRuntimeValidation: func(t *testing.T, stack integration.RuntimeValidationStackInfo) {
+				functions := resourcesOfType(stack, "aws:lambda/function:Function")
+				if !assert.Len(t, functions, 1) {
+					return
+				}
+				permissions := resourcesOfType(stack, "aws:lambda/permission:Permission")
+				if assert.Len(t, permissions, 1) {
+					assert.Equal(t, "ses.amazonaws.com", permissions[0].Outputs["principal"])
+					// The permission is restricted to receipt rules in the function's own account.
+					assert.Equal(t, strings.Split(functions[0].Outputs["arn"].(string), ":")[4],
+						permissions[0].Outputs["sourceAccount"])
+				}
+				rules := resourcesOfType(stack, "aws:ses/receiptRule:ReceiptRule")
+				if assert.Len(t, rules, 1) {
+					actions := rules[0].Outputs["lambdaActions"].([]interface{})
+					if assert.Len(t, actions, 1) {
+						action := actions[0].(map[string]interface{})
+						assert.Equal(t, functions[0].Outputs["arn"], action["functionArn"])
+					}
+				}
+
+				// The function's role can only write to its own log group.
+				assert.Empty(t, resourcesOfType(stack, "aws:iam/rolePolicyAttachment:RolePolicyAttachment"))
+				policies := resourcesOfType(stack, "aws:iam/rolePolicy:RolePolicy")
+				if assert.Len(t, policies, 1) {
+					var document struct {
+						Statement []struct {
+							Action   []string
+							Resource string
+						}
+					}
+					if assert.NoError(t, json.Unmarshal([]byte(policies[0].Outputs["policy"].(string)), &document)) &&
+						assert.Len(t, document.Statement, 1) {
+						statement := document.Statement[0]
+						assert.ElementsMatch(t, []string{"logs:CreateLogStream", "logs:PutLogEvents"}, statement.Action)
+						assert.Equal(t, fmt.Sprintf("arn:aws:logs:*:*:log-group:/aws/lambda/%v:*",
+							functions[0].Outputs["name"]), statement.Resource)
+					}
+				}
+			},
+		}},
+		{dir: "stepfunctions", options: integration.ProgramTestOptions{
+			ExtraRuntimeValidation: func(t *testing.T, stack integration.RuntimeValidationStackInfo) {
+				functions := resourcesOfType(stack, "aws:lambda/function:Function")
+				if !assert.Len(t, functions, 2) {
+					return
+				}
+				policies := resourcesOfType(stack, "aws:iam/rolePolicy:RolePolicy")
+				machines := resourcesOfType(stack, "aws:sfn/stateMachine:StateMachine")
+				if !assert.Len(t, policies, 1) || !assert.Len(t, machines, 1) {
+					return
+				}
+				assert.Contains(t, policies[0].Outputs["policy"], "lambda:InvokeFunction")
+				for _, function := range functions {
+					assert.Contains(t, policies[0].Outputs["policy"], function.Outputs["arn"])
+					assert.Contains(t, machines[0].Outputs["definition"], function.Outputs["arn"])
+				}
+			},
+		}},
+		{dir: "subscription", options: integration.ProgramTestOptions{
+			ExtraRuntimeValidation: func(t *testing.T, stack integration.RuntimeValidationStackInfo) {
+				// A single function is shared by the mappings for both of the ledger's queues and its subscription to
+				// the topic.
+				ledger, ok := resourceNamed(t, stack, "aws:lambda/function:Function", "ledger-sources-subscription")
+				if !ok {
+					return
+				}
+				functionArn := ledger.Outputs["arn"]
+
+				var mappingSources []interface{}
+				for _, mapping := range resourcesOfType(stack, "aws:lambda/eventSourceMapping:EventSourceMapping") {
+					if mapping.Outputs["functionArn"] == functionArn {
+						mappingSources = append(mappingSources, mapping.Outputs["eventSourceArn"])
+					}
+				}
+				var ledgerQueueArns []interface{}
+				for _, queueName := range []string{"orders", "refunds"} {
+					if queue, ok := resourceNamed(t, stack, "aws:sqs/queue:Queue", queueName); ok {
+						ledgerQueueArns = append(ledgerQueueArns, queue.Outputs["arn"])
+					}
+				}
+				assert.ElementsMatch(t, ledgerQueueArns, mappingSources)
+
+				if subscription, ok := resourceNamed(t, stack, "aws:sns/topicSubscription:TopicSubscription",
+					"ledger-sns-2"); ok {
+					assert.Equal(t, "lambda", subscription.Outputs["protocol"])
+					assert.Equal(t, functionArn, subscription.Outputs["endpoint"])
+				}
+				if permission, ok := resourceNamed(t, stack, "aws:lambda/permission:Permission", "ledger-sns-2"); ok {
+					assert.Equal(t, "sns.amazonaws.com", permission.Outputs["principal"])
+				}
+
+				// The reconciler's role has no managed policies, only those allowing it to write its logs and to
+				// receive from its queue.  Its queue's mapping waits for both, and its topic's subscription for
+				// the first.
+				if role, ok := resourceNamed(t, stack, "aws:iam/role:Role", "reconciler-sources-subscription"); ok {
+					assert.Empty(t, attachedPolicies(stack, role))
+				}
+				loggingPolicy, loggingOK := resourceNamed(t, stack, "aws:iam/rolePolicy:RolePolicy",
+					"reconciler-sources-subscription-logging")
+				readPolicy, readOK := resourceNamed(t, stack, "aws:iam/rolePolicy:RolePolicy", "reconciler-sqs-0-read")
+				if readOK {
+					assert.Contains(t, readPolicy.Outputs["policy"], "sqs:ReceiveMessage")
+					assert.Contains(t, readPolicy.Outputs["policy"], stack.Outputs["paymentsArn"])
+				}
+				if mapping, ok := resourceNamed(t, stack, "aws:lambda/eventSourceMapping:EventSourceMapping",
+					"reconciler-sqs-0"); ok && loggingOK && readOK {
+					assert.Equal(t, stack.Outputs["paymentsArn"], mapping.Outputs["eventSourceArn"])
+					assert.Equal(t, "Enabled", mapping.Outputs["state"])
+					assert.Contains(t, mapping.Dependencies, readPolicy.URN)
+					assert.Contains(t, mapping.Dependencies, loggingPolicy.URN)
+				}
+				if subscription, ok := resourceNamed(t, stack, "aws:sns/topicSubscription:TopicSubscription",
+					"reconciler-sns-1"); ok && loggingOK {
+					assert.Contains(t, subscription.Dependencies, loggingPolicy.URN)
+				}
+			},
+		}},
+		{dir: "topic", options: integration.ProgramTestOptions{
+			ExtraRuntimeValidation: func(t *testing.T, stack integration.RuntimeValidationStackInfo) {
+				var filterPolicies []interface{}
+				for _, sub := range resourcesOfType(stack, "aws:sns/topicSubscription:TopicSubscription") {
+					if policy, has := sub.Outputs["filterPolicy"]; has && policy != "" {
+						filterPolicies = append(filterPolicies, policy)
+					}
+				}
+				if assert.Len(t, filterPolicies, 1) {
+					assert.JSONEq(t, `{"eventType":["order_created"]}`, filterPolicies[0].(string))
+				}
+
+				// Undeliverable orders and shipments are sent to the dead-letter queue, whose single policy allows both
+				// topics to send to it, and is named after the first subscription using it.
+				failures := resourcesOfType(stack, "aws:sqs/queue:Queue")
+				var redrivePolicies []interface{}
+				for _, sub := range resourcesOfType(stack, "aws:sns/topicSubscription:TopicSubscription") {
+					if policy, has := sub.Outputs["redrivePolicy"]; has && policy != "" {
+						redrivePolicies = append(redrivePolicies, policy)
+					}
+				}
+				queuePolicies := resourcesOfType(stack, "aws:sqs/queuePolicy:QueuePolicy")
+				if assert.Len(t, failures, 1) && assert.Len(t, redrivePolicies, 2) && assert.Len(t, queuePolicies, 1) {
+					for _, redrivePolicy := range redrivePolicies {
+						var redrive struct {
+							DeadLetterTargetArn string `json:"deadLetterTargetArn"`
+						}
+						if assert.NoError(t, json.Unmarshal([]byte(redrivePolicy.(string)), &redrive)) {
+							assert.Equal(t, failures[0].Outputs["arn"], redrive.DeadLetterTargetArn)
+						}
+					}
+					assert.True(t, strings.HasSuffix(string(queuePolicies[0].URN), "::order-created-dead-letter"))
+					assert.Equal(t, failures[0].Outputs["url"], queuePolicies[0].Outputs["queueUrl"])
+					assert.Contains(t, queuePolicies[0].Outputs["policy"], "sns.amazonaws.com")
+					for _, topic := range resourcesOfType(stack, "aws:sns/topic:Topic") {
+						if !strings.HasSuffix(string(topic.URN), "::order-alarms") {
+							assert.Contains(t, queuePolicies[0].Outputs["policy"], topic.Outputs["arn"])
+						}
+					}
+				}
+
+				var layerArns []interface{}
+				for _, layer := range resourcesOfType(stack, "aws:lambda/layerVersion:LayerVersion") {
+					layerArns = append(layerArns, layer.Outputs["arn"])
+				}
+				var functionLayers [][]interface{}
+				var orderCreatedName interface{}
+				for _, function := range resourcesOfType(stack, "aws:lambda/function:Function") {
+					if layers, has := function.Outputs["layers"].([]interface{}); has && len(layers) > 0 {
+						functionLayers = append(functionLayers, layers)
+						orderCreatedName = function.Outputs["name"]
+					}
+				}
+				if assert.Len(t, functionLayers, 1) {
+					assert.ElementsMatch(t, layerArns, functionLayers[0])
+				}
+
+				var alarmMetrics []interface{}
+				for _, alarm := range resourcesOfType(stack, "aws:cloudwatch/metricAlarm:MetricAlarm") {
+					alarmMetrics = append(alarmMetrics, alarm.Outputs["metricName"])
+					assert.Equal(t, "AWS/Lambda", alarm.Outputs["namespace"])
+					assert.Equal(t, map[string]interface{}{"FunctionName": orderCreatedName}, alarm.Outputs["dimensions"])
+					if alarm.Outputs["metricName"] == "Errors" {
+						assert.Equal(t, float64(5), alarm.Outputs["threshold"])
+						assert.Equal(t, float64(300), alarm.Outputs["period"])
+					}
+				}
+				assert.ElementsMatch(t, []interface{}{"Errors", "Throttles"}, alarmMetrics)
+
+				// The handlers read the messages' attributes and subjects as typed.
+				assertHandlerReads(t, stack, "order-created-topic-subscription", "Sns.MessageAttributes", "eventType.Value")
+				assertHandlerReads(t, stack, "order-shipped-topic-subscription", "Sns.Subject")
+			},
+			EditDirs: []integration.EditDir{
+				{
+					Dir:           "./topic/step2",
+					Stdout:        &topicOutput,
+					ExpectFailure: true,
+				},
+				{
+					// Restore the original program, checking the failed update reported which handler was at fault.
+					Dir: "./topic",
+					ExtraRuntimeValidation: func(t *testing.T, stack integration.RuntimeValidationStackInfo) {
+						assert.Contains(t, topicOutput.String(),
+							"The handler for subscription 'notify-connection' (topic events) could not be serialized")
+					},
+				},
+			},
+		}},
+		{dir: "asset", options: integration.ProgramTestOptions{
+			ExtraRuntimeValidation: func(t *testing.T, stack integration.RuntimeValidationStackInfo) {
+				functions := map[interface{}]apitype.ResourceV2{}
+				for _, function := range resourcesOfType(stack, "aws:lambda/function:Function") {
+					functions[function.Outputs["runtime"]] = function
+				}
+				if !assert.Len(t, functions, 2) {
+					return
+				}
+
+				nodeFunction := functions["nodejs20.x"]
+				assert.Equal(t, "index.handler", nodeFunction.Outputs["handler"])
+				explicitName := fmt.Sprintf("log-message-%s", stack.StackName)
+				assert.Equal(t, explicitName, nodeFunction.Outputs["name"])
+				var roleNames []interface{}
+				for _, role := range resourcesOfType(stack, "aws:iam/role:Role") {
+					roleNames = append(roleNames, role.Outputs["name"])
+				}
+				assert.Contains(t, roleNames, explicitName)
+				subscriptions := resourcesOfType(stack, "aws:sns/topicSubscription:TopicSubscription")
+				if assert.Len(t, subscriptions, 1) {
+					assert.Equal(t, "lambda", subscriptions[0].Outputs["protocol"])
+					assert.Equal(t, nodeFunction.Outputs["arn"], subscriptions[0].Outputs["endpoint"])
+				}
+
+				// The custom runtime function defaults to starting its bootstrap executable.
+				customFunction := functions["provided.al2"]
+				assert.Equal(t, "bootstrap", customFunction.Outputs["handler"])
+				mappings := resourcesOfType(stack, "aws:lambda/eventSourceMapping:EventSourceMapping")
+				if assert.Len(t, mappings, 1) {
+					assert.Equal(t, customFunction.Outputs["arn"], mappings[0].Outputs["functionArn"])
+					assert.Equal(t, float64(10), mappings[0].Outputs["batchSize"])
+				}
+			},
+			EditDirs: []integration.EditDir{
+				{
+					Dir:           "./asset/step2",
+					ExpectFailure: true,
+				},
 			},
-			Dependencies: []string{
-				"@pulumi/aws-serverless",
+		}},
+		{dir: "queue", options: integration.ProgramTestOptions{
+			ExtraRuntimeValidation: func(t *testing.T, stack integration.RuntimeValidationStackInfo) {
+				// The topic subscription reuses the queue subscription's function rather than creating its own.
+				functions := resourcesOfType(stack, "aws:lambda/function:Function")
+				if assert.Len(t, functions, 1) {
+					assert.Equal(t, functions[0].Outputs["arn"], stack.Outputs["subscriptionFunctionArn"])
+					assert.Equal(t, functions[0].Outputs["role"], stack.Outputs["subscriptionRoleArn"])
+				}
+				mappings := resourcesOfType(stack, "aws:lambda/eventSourceMapping:EventSourceMapping")
+				if assert.Len(t, mappings, 1) {
+					assert.Equal(t, mappings[0].Outputs["uuid"], stack.Outputs["subscriptionMappingUuid"])
+					assert.Equal(t, map[string]interface{}{"maximumConcurrency": float64(5)},
+						mappings[0].Outputs["scalingConfig"])
+					assert.Equal(t, float64(1), mappings[0].Outputs["maximumBatchingWindowInSeconds"])
+				}
+
+				var policyArns []interface{}
+				for _, attachment := range resourcesOfType(stack, "aws:iam/rolePolicyAttachment:RolePolicyAttachment") {
+					policyArns = append(policyArns, attachment.Outputs["policyArn"])
+				}
+				assert.Contains(t, policyArns, "arn:aws:iam::aws:policy/AmazonS3FullAccess")
+
+				policies := resourcesOfType(stack, "aws:iam/rolePolicy:RolePolicy")
+				if assert.Len(t, policies, 1) {
+					assert.Contains(t, policies[0].Outputs["policy"], "dynamodb:PutItem")
+				}
+
+				// Both the orders and returns topics are fanned out to the queue, whose single policy allows each of
+				// them to send to it, and is named after the first subscription to it.
+				var fannedOutTopicArns []interface{}
+				for _, topic := range resourcesOfType(stack, "aws:sns/topic:Topic") {
+					urn := string(topic.URN)
+					if strings.HasSuffix(urn, "::orders") || strings.HasSuffix(urn, "::returns") {
+						fannedOutTopicArns = append(fannedOutTopicArns, topic.Outputs["arn"])
+					}
+				}
+				var queueSubscriptions []apitype.ResourceV2
+				var subscribedTopicArns []interface{}
+				for _, sub := range resourcesOfType(stack, "aws:sns/topicSubscription:TopicSubscription") {
+					if sub.Outputs["protocol"] == "sqs" {
+						queueSubscriptions = append(queueSubscriptions, sub)
+						subscribedTopicArns = append(subscribedTopicArns, sub.Outputs["topic"])
+						assert.Equal(t, true, sub.Outputs["rawMessageDelivery"])
+					}
+				}
+				if assert.Len(t, queueSubscriptions, 2) && assert.Len(t, fannedOutTopicArns, 2) {
+					assert.ElementsMatch(t, fannedOutTopicArns, subscribedTopicArns)
+				}
+				queuePolicies := resourcesOfType(stack, "aws:sqs/queuePolicy:QueuePolicy")
+				if assert.Len(t, queuePolicies, 1) {
+					assert.True(t, strings.HasSuffix(string(queuePolicies[0].URN), "::orders-to-queue"))
+					for _, topicArn := range fannedOutTopicArns {
+						assert.Contains(t, queuePolicies[0].Outputs["policy"], topicArn)
+					}
+				}
+
+				// The queue's visibility timeout is six times its handler's 45 second timeout, and its failed messages
+				// are moved to the dead-letter queue created for it.
+				var sourceQueue, deadLetterQueue apitype.ResourceV2
+				queues := resourcesOfType(stack, "aws:sqs/queue:Queue")
+				if !assert.Len(t, queues, 2) {
+					return
+				}
+				for _, queue := range queues {
+					if policy, has := queue.Outputs["redrivePolicy"]; has && policy != "" {
+						sourceQueue = queue
+					} else {
+						deadLetterQueue = queue
+					}
+				}
+				assert.Equal(t, float64(270), sourceQueue.Outputs["visibilityTimeoutSeconds"])
+				assert.Equal(t, float64(1209600), deadLetterQueue.Outputs["messageRetentionSeconds"])
+				var redrivePolicy map[string]interface{}
+				if assert.NoError(t, json.Unmarshal([]byte(sourceQueue.Outputs["redrivePolicy"].(string)), &redrivePolicy)) {
+					assert.Equal(t, deadLetterQueue.Outputs["arn"], redrivePolicy["deadLetterTargetArn"])
+					assert.Equal(t, float64(3), redrivePolicy["maxReceiveCount"])
+				}
+
+				assertHandlerReads(t, stack, "subscription-queue-subscription", "record.messageId", "record.body")
+			},
+			EditDirs: []integration.EditDir{
+				{
+					Dir:           "./queue/step2",
+					ExpectFailure: true,
+				},
+				{
+					Dir:           "./queue/step3",
+					Stdout:        &queueOutput,
+					ExpectFailure: true,
+				},
+				{
+					Dir:           "./queue/step4",
+					ExpectFailure: true,
+				},
+				{
+					Dir:           "./queue/step5",
+					ExpectFailure: true,
+				},
+				{
+					Dir: "./queue/step6",
+					ExtraRuntimeValidation: func(t *testing.T, stack integration.RuntimeValidationStackInfo) {
+						// The orders queue and the dead-letter queue created for it are both FIFO queues, named as
+						// SQS requires.
+						queues := resourcesOfType(stack, "aws:sqs/queue:Queue")
+						if !assert.Len(t, queues, 2) {
+							return
+						}
+						for _, queue := range queues {
+							assert.Equal(t, true, queue.Outputs["fifoQueue"])
+							assert.Equal(t, true, queue.Outputs["contentBasedDeduplication"])
+							assert.True(t, strings.HasSuffix(queue.Outputs["name"].(string), ".fifo"))
+						}
+						mappings := resourcesOfType(stack, "aws:lambda/eventSourceMapping:EventSourceMapping")
+						if assert.Len(t, mappings, 1) {
+							assert.Equal(t, stack.Outputs["ordersArn"], mappings[0].Outputs["eventSourceArn"])
+							assert.Equal(t, float64(10), mappings[0].Outputs["batchSize"])
+							assert.Equal(t, []interface{}{"ReportBatchItemFailures"}, mappings[0].Outputs["functionResponseTypes"])
+						}
+
+						// The handler reads the message group, which only messages from FIFO queues carry.
+						assertHandlerReads(t, stack, "process-orders-queue-subscription", "attributes.MessageGroupId")
+					},
+				},
+				{
+					Dir: "./queue",
+					ExtraRuntimeValidation: func(t *testing.T, stack integration.RuntimeValidationStackInfo) {
+						assert.Contains(t, queueOutput.String(),
+							"Subscription 'subscription' has a batchSize of 100, but SQS only supports values between 1 and 10.")
+					},
+				},
+			},
+		}},
+		{dir: "function", options: integration.ProgramTestOptions{
+			Stdout: &functionOutput,
+			ExtraRuntimeValidation: func(t *testing.T, stack integration.RuntimeValidationStackInfo) {
+				// The subscription given a role runs as it, and has no role or policies created for it.
+				if fn, ok := resourceNamed(t, stack, "aws:lambda/function:Function", "shared-role-topic-subscription"); ok {
+					assert.Equal(t, stack.Outputs["sharedRoleArn"], fn.Outputs["role"])
+				}
+				for _, typ := range []string{"aws:iam/role:Role", "aws:iam/rolePolicyAttachment:RolePolicyAttachment"} {
+					for _, res := range resourcesOfType(stack, typ) {
+						assert.NotContains(t, string(res.URN), "::shared-role-topic-subscription")
+					}
+				}
+
+				// The function in the VPC is attached to its subnet, and its role may manage the interfaces it uses.
+				if fn, ok := resourceNamed(t, stack, "aws:lambda/function:Function", "in-vpc-topic-subscription"); ok {
+					vpcConfig := fn.Outputs["vpcConfig"].(map[string]interface{})
+					assert.Equal(t, []interface{}{stack.Outputs["subnetId"]}, vpcConfig["subnetIds"])
+					assert.Equal(t, []interface{}{stack.Outputs["securityGroupId"]}, vpcConfig["securityGroupIds"])
+				}
+				if role, ok := resourceNamed(t, stack, "aws:iam/role:Role", "in-vpc-topic-subscription"); ok {
+					assert.Contains(t, attachedPolicies(stack, role),
+						"arn:aws:iam::aws:policy/service-role/AWSLambdaVPCAccessExecutionRole")
+				}
+
+				// The function with a dead-letter queue sends its failed events there, and its role may do so.
+				if fn, ok := resourceNamed(t, stack, "aws:lambda/function:Function",
+					"with-dead-letter-queue-topic-subscription"); ok {
+					assert.Equal(t, map[string]interface{}{"targetArn": stack.Outputs["failedEventsArn"]},
+						fn.Outputs["deadLetterConfig"])
+				}
+				if policy, ok := resourceNamed(t, stack, "aws:iam/rolePolicy:RolePolicy",
+					"with-dead-letter-queue-topic-subscription-dead-letter"); ok {
+					assert.Contains(t, policy.Outputs["policy"], "sqs:SendMessage")
+					assert.Contains(t, policy.Outputs["policy"], stack.Outputs["failedEventsArn"])
+				}
+
+				// The function with destinations sends the results of its invocations to them, still retrying failed
+				// invocations twice as Lambda does by default, and its role may deliver to both.
+				if config, ok := resourceNamed(t, stack, "aws:lambda/functionEventInvokeConfig:FunctionEventInvokeConfig",
+					"with-destinations-topic-subscription"); ok {
+					assert.Equal(t, float64(2), config.Outputs["maximumRetryAttempts"])
+					assert.Equal(t, map[string]interface{}{
+						"onSuccess": map[string]interface{}{"destination": stack.Outputs["resultsArn"]},
+						"onFailure": map[string]interface{}{"destination": stack.Outputs["failedEventsArn"]},
+					}, config.Outputs["destinationConfig"])
+				}
+				deliveries := map[string][]interface{}{
+					"with-destinations-topic-subscription-on-success": {"sns:Publish", stack.Outputs["resultsArn"]},
+					"with-destinations-topic-subscription-on-failure": {"sqs:SendMessage", stack.Outputs["failedEventsArn"]},
+				}
+				for policyName, delivery := range deliveries {
+					if policy, ok := resourceNamed(t, stack, "aws:iam/rolePolicy:RolePolicy", policyName); ok {
+						assert.Contains(t, policy.Outputs["policy"], delivery[0])
+						assert.Contains(t, policy.Outputs["policy"], delivery[1])
+					}
+				}
+
+				// The log groups of functions given a retention are created under the name Lambda writes to, and
+				// those of the others are left for Lambda to create.
+				fn, fnOK := resourceNamed(t, stack, "aws:lambda/function:Function", "short-lived-logs-topic-subscription")
+				logGroup, logGroupOK := resourceNamed(t, stack, "aws:cloudwatch/logGroup:LogGroup",
+					"short-lived-logs-topic-subscription")
+				if fnOK && logGroupOK {
+					assert.Equal(t, "/aws/lambda/"+fn.Outputs["name"].(string), logGroup.Outputs["name"])
+					assert.Equal(t, float64(7), logGroup.Outputs["retentionInDays"])
+				}
+				assertNoLogGroups(t, stack, "shared-role-topic-subscription", "public-topic-subscription")
+
+				// Calling the public function has Lambda create its log group, as it would have for the functions of
+				// stacks deployed before log groups could be created explicitly, which the next update must leave be.
+				resp, err := http.Get(stack.Outputs["publicUrl"].(string))
+				if assert.NoError(t, err) {
+					resp.Body.Close()
+					assert.Equal(t, http.StatusOK, resp.StatusCode)
+				}
+
+				// The traced function is actively traced, and its role may send the traces to X-Ray.
+				if fn, ok := resourceNamed(t, stack, "aws:lambda/function:Function", "traced-topic-subscription"); ok {
+					assert.Equal(t, map[string]interface{}{"mode": "Active"}, fn.Outputs["tracingConfig"])
+				}
+				if role, ok := resourceNamed(t, stack, "aws:iam/role:Role", "traced-topic-subscription"); ok {
+					assert.Contains(t, attachedPolicies(stack, role), "arn:aws:iam::aws:policy/AWSXRayDaemonWriteAccess")
+				}
+
+				// The default tags apply to every subscription, and the tagged subscription's own tags to each of the
+				// resources created for it.
+				if fn, ok := resourceNamed(t, stack, "aws:lambda/function:Function", "in-vpc-topic-subscription"); ok {
+					assert.Equal(t, map[string]interface{}{"project": "serverless-function"}, fn.Outputs["tags"])
+				}
+				for _, typ := range []string{
+					"aws:lambda/function:Function", "aws:iam/role:Role", "aws:cloudwatch/logGroup:LogGroup",
+				} {
+					if res, ok := resourceNamed(t, stack, typ, "tagged-topic-subscription"); ok {
+						assert.Equal(t, map[string]interface{}{"project": "serverless-function", "team": "billing"},
+							res.Outputs["tags"], "tags of %v", typ)
+					}
+				}
+
+				// The warm function's messages are delivered to the alias its provisioned concurrency is configured for.
+				if fn, ok := resourceNamed(t, stack, "aws:lambda/function:Function", "warm-queue-subscription"); ok {
+					assert.Equal(t, float64(5), fn.Outputs["reservedConcurrentExecutions"])
+				}
+				alias, aliasOK := resourceNamed(t, stack, "aws:lambda/alias:Alias", "warm-queue-subscription")
+				if aliasOK {
+					assert.Equal(t, "live", alias.Outputs["name"])
+				}
+				if config, ok := resourceNamed(t, stack, "aws:lambda/provisionedConcurrencyConfig:ProvisionedConcurrencyConfig",
+					"warm-queue-subscription"); ok {
+					assert.Equal(t, "live", config.Outputs["qualifier"])
+					assert.Equal(t, float64(1), config.Outputs["provisionedConcurrentExecutions"])
+				}
+				var warmMappings []apitype.ResourceV2
+				for _, mapping := range resourcesOfType(stack, "aws:lambda/eventSourceMapping:EventSourceMapping") {
+					if mapping.Outputs["uuid"] == stack.Outputs["warmMappingUuid"] {
+						warmMappings = append(warmMappings, mapping)
+					}
+				}
+				if assert.Len(t, warmMappings, 1) && aliasOK {
+					assert.Equal(t, alias.Outputs["arn"], warmMappings[0].Inputs["functionName"])
+				}
+
+				// The least privileged function's role has no managed policies, only those allowing it to write its
+				// logs and to receive from its queue, which its mapping waits for.
+				if role, ok := resourceNamed(t, stack, "aws:iam/role:Role", "least-privilege-queue-subscription"); ok {
+					assert.Empty(t, attachedPolicies(stack, role))
+				}
+				if policy, ok := resourceNamed(t, stack, "aws:iam/rolePolicy:RolePolicy",
+					"least-privilege-queue-subscription-logging"); ok {
+					assert.Contains(t, policy.Outputs["policy"], "logs:PutLogEvents")
+					// Its log group is left for Lambda to create, so the role must be allowed to create it.
+					assert.Contains(t, policy.Outputs["policy"], "logs:CreateLogGroup")
+				}
+				readPolicy, readOK := resourceNamed(t, stack, "aws:iam/rolePolicy:RolePolicy", "least-privilege-read")
+				if readOK {
+					assert.Contains(t, readPolicy.Outputs["policy"], "sqs:ReceiveMessage")
+					assert.Contains(t, readPolicy.Outputs["policy"], stack.Outputs["auditsArn"])
+				}
+				if mapping, ok := resourceNamed(t, stack, "aws:lambda/eventSourceMapping:EventSourceMapping",
+					"least-privilege"); ok && readOK {
+					assert.Equal(t, stack.Outputs["auditsArn"], mapping.Outputs["eventSourceArn"])
+					assert.Equal(t, "Enabled", mapping.Outputs["state"])
+					assert.Contains(t, mapping.Dependencies, readPolicy.URN)
+				}
+			},
+			EditDirs: []integration.EditDir{{
+				// Updating the public function, whose log group Lambda has now created, succeeds without the log
+				// group being created over it.
+				Dir:      "./function/step2",
+				Additive: true,
+				ExtraRuntimeValidation: func(t *testing.T, stack integration.RuntimeValidationStackInfo) {
+					if fn, ok := resourceNamed(t, stack, "aws:lambda/function:Function", "public-topic-subscription"); ok {
+						assert.Equal(t, float64(10), fn.Outputs["timeout"])
+					}
+					assertNoLogGroups(t, stack, "public-topic-subscription")
+				},
+			}, {
+				Dir:           "./function/step3",
+				Additive:      true,
+				ExpectFailure: true,
+			}, {
+				// Restore the previous program, checking the failed update rejected the dead-letter target.
+				Dir:      "./function/step2",
+				Additive: true,
+				ExtraRuntimeValidation: func(t *testing.T, stack integration.RuntimeValidationStackInfo) {
+					assert.Contains(t, functionOutput.String(),
+						"Function 'misdirected-dead-letters-topic-subscription' has a deadLetterConfig of 'arn:aws:ec2:")
+					assert.Contains(t, functionOutput.String(), "but it must be the ARN of one of: sqs, sns.")
+				},
+			}},
+		}},
+		{dir: "httpapi", options: integration.ProgramTestOptions{
+			ExtraRuntimeValidation: func(t *testing.T, stack integration.RuntimeValidationStackInfo) {
+				assert.Len(t, resourcesOfType(stack, "aws:apigatewayv2/integration:Integration"), 2)
+				assert.Len(t, resourcesOfType(stack, "aws:apigatewayv2/route:Route"), 2)
+				assert.Len(t, resourcesOfType(stack, "aws:apigatewayv2/stage:Stage"), 1)
+				assert.Len(t, resourcesOfType(stack, "aws:lambda/permission:Permission"), 2)
+
+				apis := resourcesOfType(stack, "aws:apigatewayv2/api:Api")
+				if assert.Len(t, apis, 1) {
+					cors := apis[0].Outputs["corsConfiguration"].(map[string]interface{})
+					assert.Equal(t, []interface{}{"https://example.com", "https://www.example.com"}, cors["allowOrigins"])
+					assert.Equal(t, []interface{}{"GET"}, cors["allowMethods"])
+					assert.Equal(t, float64(600), cors["maxAge"])
+				}
+
+				resp, err := http.Get(stack.Outputs["url"].(string) + "items")
+				if !assert.NoError(t, err) {
+					return
+				}
+				defer resp.Body.Close()
+				body, err := ioutil.ReadAll(resp.Body)
+				assert.NoError(t, err)
+				assert.Equal(t, "Hello, world!", string(body))
+			},
+		}},
+		{dir: "websocket", options: integration.ProgramTestOptions{
+			ExtraRuntimeValidation: func(t *testing.T, stack integration.RuntimeValidationStackInfo) {
+				apis := resourcesOfType(stack, "aws:apigatewayv2/api:Api")
+				if assert.Len(t, apis, 1) {
+					assert.Equal(t, "WEBSOCKET", apis[0].Outputs["protocolType"])
+				}
+				var routeKeys []interface{}
+				for _, route := range resourcesOfType(stack, "aws:apigatewayv2/route:Route") {
+					routeKeys = append(routeKeys, route.Outputs["routeKey"])
+				}
+				assert.ElementsMatch(t, []interface{}{"$connect", "sendMessage"}, routeKeys)
+				assert.Len(t, resourcesOfType(stack, "aws:apigatewayv2/integration:Integration"), 2)
+				assert.Len(t, resourcesOfType(stack, "aws:apigatewayv2/stage:Stage"), 1)
+				assert.Len(t, resourcesOfType(stack, "aws:lambda/permission:Permission"), 2)
+			},
+		}},
+		{dir: "api", options: integration.ProgramTestOptions{
+			Config: apiConfig,
+			ExtraRuntimeValidation: func(t *testing.T, stack integration.RuntimeValidationStackInfo) {
+				validateAPITest(func(body string) {
+					assert.Equal(t, "Hello, world!", body)
+				})(t, stack)
+				validateAPICors(t, stack)
+				validateAPIRequestSchema(t, stack)
+				validateAPIBinaryMediaTypes(t, stack)
+				validateAPIUsagePlan(t, stack)
+				validateAPIStage(t, stack)
+				if apiDomainName != "" {
+					validateAPIDomain(t, stack, apiDomainName)
+				}
 			},
-			ExtraRuntimeValidation: validateAPITest(func(body string) {
-				assert.Equal(t, "Hello, world!", body)
-			}),
 			EditDirs: []integration.EditDir{{
 				Dir:      "./api/step2",
 				Additive: true,
@@ -94,22 +1075,82 @@ func Test_Examples(t *testing.T) {
 					assert.Equal(t, "<h1>Hello world!</h1>", body)
 				}),
 			}},
-		},
+		}},
 	}
 	for _, ex := range examples {
-		example := ex.With(integration.ProgramTestOptions{
-			ReportStats: integration.NewS3Reporter("us-west-2", "eng.pulumi.com", "testreports"),
-			Tracing:     "https://tracing.pulumi-engineering.com/collector/api/v1/spans",
-			// TODO[pulumi/pulumi#1900]: This should be the default value, every test we have causes some sort of
-			// change during a `pulumi refresh` for reasons outside our control.
-			ExpectRefreshChanges: true,
-		})
+		example := ex.programTestOptions(cwd, region)
 		t.Run(example.Dir, func(t *testing.T) {
 			integration.ProgramTest(t, &example)
 		})
 	}
 }
 
+// exampleTest is an entry in the table of examples run by Test_Examples.  Only what differs from baseOptions needs to
+// be given, so an example without further validation is a single line.
+type exampleTest struct {
+	// dir is the example's directory, relative to this one.
+	dir string
+	// forceRegion, if set, is the region the example is deployed to in place of AWS_REGION.
+	forceRegion string
+	// options are applied over the example's base options, i.e. to validate its stack or to add further steps.
+	options integration.ProgramTestOptions
+	// config, if set, returns further configuration for the example, computed only as it is about to run, i.e. for
+	// times relative to its deployment.
+	config func() map[string]string
+}
+
+// programTestOptions returns the options [ex] is run with, deploying it to [region] unless it forces another.
+func (ex exampleTest) programTestOptions(cwd, region string) integration.ProgramTestOptions {
+	if ex.forceRegion != "" {
+		region = ex.forceRegion
+	}
+	options := baseOptions(path.Join(cwd, ex.dir), region).With(ex.options)
+	if ex.config != nil {
+		for key, value := range ex.config() {
+			options.Config[key] = value
+		}
+	}
+	return options
+}
+
+// baseOptions returns the options shared by every example: the example in [dir] is deployed to [region] against this
+// package, with its results reported and traced.
+func baseOptions(dir, region string) integration.ProgramTestOptions {
+	return integration.ProgramTestOptions{
+		Dir: dir,
+		Config: map[string]string{
+			"aws:region": region,
+		},
+		Dependencies: []string{
+			"@pulumi/aws-serverless",
+		},
+		ReportStats: integration.NewS3Reporter("us-west-2", "eng.pulumi.com", "testreports"),
+		Tracing:     "https://tracing.pulumi-engineering.com/collector/api/v1/spans",
+		// TODO[pulumi/pulumi#1900]: This should be the default value, every test we have causes some sort of
+		// change during a `pulumi refresh` for reasons outside our control.
+		ExpectRefreshChanges: true,
+	}
+}
+
+func Test_ExampleRegions(t *testing.T) {
+	// Examples forcing a region are deployed to it whatever AWS_REGION is, even when it is unset, while the rest
+	// follow AWS_REGION.
+	for _, region := range []string{"", "us-west-2", "eu-west-1"} {
+		forced := exampleTest{dir: "topic", forceRegion: "us-east-1"}.programTestOptions("/examples", region)
+		assert.Equal(t, "us-east-1", forced.Config["aws:region"])
+		assert.Equal(t, "/examples/topic", forced.Dir)
+
+		topic := exampleTest{dir: "topic"}.programTestOptions("/examples", region)
+		assert.Equal(t, region, topic.Config["aws:region"])
+	}
+
+	// Configuration given by an example is added to the base configuration rather than replacing it.
+	api := exampleTest{dir: "api", options: integration.ProgramTestOptions{
+		Config: map[string]string{"domainName": "api.example.com"},
+	}}.programTestOptions("/examples", "us-west-2")
+	assert.Equal(t, map[string]string{"aws:region": "us-west-2", "domainName": "api.example.com"}, api.Config)
+}
+
 func validateAPITest(isValid func(body string)) func(t *testing.T, stack integration.RuntimeValidationStackInfo) {
 	return func(t *testing.T, stack integration.RuntimeValidationStackInfo) {
 		var resp *http.Response
@@ -132,3 +1173,258 @@ func validateAPITest(isValid func(body string)) func(t *testing.T, stack integra
 		isValid(string(body))
 	}
 }
+
+// validateAPICors checks that every path in the REST API has an OPTIONS method answering preflight requests with the
+// example's CORS settings.
+func validateAPICors(t *testing.T, stack integration.RuntimeValidationStackInfo) {
+	apis := resourcesOfType(stack, "aws:apigateway/restApi:RestApi")
+	if !assert.Len(t, apis, 1) {
+		return
+	}
+	var spec struct {
+		Paths map[string]map[string]struct {
+			Integration struct {
+				Type      string `json:"type"`
+				Responses map[string]struct {
+					ResponseParameters map[string]string `json:"responseParameters"`
+				} `json:"responses"`
+			} `json:"x-amazon-apigateway-integration"`
+		} `json:"paths"`
+	}
+	if !assert.NoError(t, json.Unmarshal([]byte(apis[0].Outputs["body"].(string)), &spec)) {
+		return
+	}
+	for path, methods := range spec.Paths {
+		options, has := methods["options"]
+		if !assert.True(t, has, "expected an OPTIONS method for %s", path) {
+			continue
+		}
+		assert.Equal(t, "mock", options.Integration.Type)
+		params := options.Integration.Responses["default"].ResponseParameters
+		assert.Equal(t, "'https://example.com'", params["method.response.header.Access-Control-Allow-Origin"])
+		assert.Equal(t, "'GET'", params["method.response.header.Access-Control-Allow-Methods"])
+		assert.Equal(t, "'Content-Type'", params["method.response.header.Access-Control-Allow-Headers"])
+		assert.Equal(t, "'600'", params["method.response.header.Access-Control-Max-Age"])
+	}
+}
+
+// validateAPIRequestSchema checks that POST /items validates its body against a model requiring a `name` string, and
+// that API Gateway rejects bodies that don't match.
+func validateAPIRequestSchema(t *testing.T, stack integration.RuntimeValidationStackInfo) {
+	apis := resourcesOfType(stack, "aws:apigateway/restApi:RestApi")
+	if !assert.Len(t, apis, 1) {
+		return
+	}
+	var spec struct {
+		Paths map[string]map[string]struct {
+			Parameters []struct {
+				In     string `json:"in"`
+				Schema struct {
+					Ref string `json:"$ref"`
+				} `json:"schema"`
+			} `json:"parameters"`
+			Validator string `json:"x-amazon-apigateway-request-validator"`
+		} `json:"paths"`
+		Definitions map[string]struct {
+			Required []string `json:"required"`
+		} `json:"definitions"`
+		Validators map[string]struct {
+			ValidateRequestBody bool `json:"validateRequestBody"`
+		} `json:"x-amazon-apigateway-request-validators"`
+	}
+	if !assert.NoError(t, json.Unmarshal([]byte(apis[0].Outputs["body"].(string)), &spec)) {
+		return
+	}
+
+	post := spec.Paths["/items"]["post"]
+	if assert.Len(t, post.Parameters, 1) {
+		assert.Equal(t, "body", post.Parameters[0].In)
+		model := strings.TrimPrefix(post.Parameters[0].Schema.Ref, "#/definitions/")
+		assert.Equal(t, []string{"name"}, spec.Definitions[model].Required)
+	}
+	assert.Equal(t, "body-only", post.Validator)
+	assert.True(t, spec.Validators["body-only"].ValidateRequestBody)
+
+	resp, err := http.Post(stack.Outputs["url"].(string)+"items", "application/json", strings.NewReader(`{}`))
+	if assert.NoError(t, err) {
+		defer resp.Body.Close()
+		assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+	}
+}
+
+func validateAPIBinaryMediaTypes(t *testing.T, stack integration.RuntimeValidationStackInfo) {
+	apis := resourcesOfType(stack, "aws:apigateway/restApi:RestApi")
+	if !assert.Len(t, apis, 1) {
+		return
+	}
+	assert.Equal(t, []interface{}{"image/png", "application/x-protobuf"}, apis[0].Outputs["binaryMediaTypes"])
+
+	var spec struct {
+		Paths map[string]map[string]struct {
+			Integration struct {
+				Type            string `json:"type"`
+				ContentHandling string `json:"contentHandling"`
+			} `json:"x-amazon-apigateway-integration"`
+		} `json:"paths"`
+	}
+	if !assert.NoError(t, json.Unmarshal([]byte(apis[0].Outputs["body"].(string)), &spec)) {
+		return
+	}
+	for path, methods := range spec.Paths {
+		for method, op := range methods {
+			if op.Integration.Type == "aws_proxy" {
+				assert.Equal(t, "CONVERT_TO_BINARY", op.Integration.ContentHandling, "%s %s", method, path)
+			}
+		}
+	}
+}
+
+func validateAPIUsagePlan(t *testing.T, stack integration.RuntimeValidationStackInfo) {
+	plans := resourcesOfType(stack, "aws:apigateway/usagePlan:UsagePlan")
+	if assert.Len(t, plans, 1) {
+		throttle := plans[0].Outputs["throttleSettings"].(map[string]interface{})
+		assert.Equal(t, float64(10), throttle["rateLimit"])
+		assert.Equal(t, float64(20), throttle["burstLimit"])
+		quota := plans[0].Outputs["quotaSettings"].(map[string]interface{})
+		assert.Equal(t, float64(1000), quota["limit"])
+		assert.Equal(t, "DAY", quota["period"])
+	}
+	assert.Len(t, resourcesOfType(stack, "aws:apigateway/apiKey:ApiKey"), 1)
+	assert.Len(t, resourcesOfType(stack, "aws:apigateway/usagePlanKey:UsagePlanKey"), 1)
+
+	apis := resourcesOfType(stack, "aws:apigateway/restApi:RestApi")
+	if !assert.Len(t, apis, 1) {
+		return
+	}
+	var spec struct {
+		Paths map[string]map[string]struct {
+			Security []map[string][]string `json:"security"`
+		} `json:"paths"`
+	}
+	if assert.NoError(t, json.Unmarshal([]byte(apis[0].Outputs["body"].(string)), &spec)) {
+		assert.Equal(t, []map[string][]string{{"api_key": {}}}, spec.Paths["/private"]["get"].Security)
+		assert.Empty(t, spec.Paths["/b"]["get"].Security)
+	}
+
+	resp, err := http.Get(stack.Outputs["url"].(string) + "private")
+	if assert.NoError(t, err) {
+		defer resp.Body.Close()
+		assert.Equal(t, http.StatusForbidden, resp.StatusCode)
+	}
+}
+
+func validateAPIDomain(t *testing.T, stack integration.RuntimeValidationStackInfo, domainName string) {
+	domains := resourcesOfType(stack, "aws:apigateway/domainName:DomainName")
+	if assert.Len(t, domains, 1) {
+		assert.Equal(t, domainName, domains[0].Outputs["domainName"])
+		assert.Equal(t, domains[0].Outputs["regionalDomainName"], stack.Outputs["domainTarget"])
+	}
+	mappings := resourcesOfType(stack, "aws:apigateway/basePathMapping:BasePathMapping")
+	if assert.Len(t, mappings, 1) {
+		assert.Equal(t, "v1", mappings[0].Outputs["basePath"])
+	}
+}
+
+// validateAPIStage checks that the REST API is deployed to the example's named stage, which logs requests to its log
+// group and traces them with X-Ray.
+func validateAPIStage(t *testing.T, stack integration.RuntimeValidationStackInfo) {
+	stages := resourcesOfType(stack, "aws:apigateway/stage:Stage")
+	if !assert.Len(t, stages, 1) {
+		return
+	}
+	assert.Equal(t, "prod", stages[0].Outputs["stageName"])
+	assert.Equal(t, true, stages[0].Outputs["xrayTracingEnabled"])
+	assert.True(t, strings.HasSuffix(stack.Outputs["url"].(string), "/prod/"))
+
+	accessLog, ok := stages[0].Outputs["accessLogSettings"].(map[string]interface{})
+	if assert.True(t, ok, "expected the stage to have access log settings") {
+		assert.Equal(t, stack.Outputs["accessLogGroupArn"], accessLog["destinationArn"])
+		assert.Contains(t, accessLog["format"], "$context.requestId")
+	}
+
+	// API Gateway needs a role to write the logs with.
+	accounts := resourcesOfType(stack, "aws:apigateway/account:Account")
+	if assert.Len(t, accounts, 1) {
+		assert.NotEmpty(t, accounts[0].Outputs["cloudwatchRoleArn"])
+	}
+}
+
+// validateBucketNotification checks that [notification] depends on the permission of every subscription to its bucket,
+// so that S3 can invoke each function by the time the configuration is applied, and that one of the functions is
+// triggered by objects under [uploadPrefix].
+func validateBucketNotification(
+	t *testing.T, stack integration.RuntimeValidationStackInfo, notification apitype.ResourceV2, uploadPrefix string) {
+
+	permissions := resourcesOfType(stack, "aws:lambda/permission:Permission")
+	assert.Len(t, permissions, 3)
+	for _, permission := range permissions {
+		assert.Contains(t, notification.Dependencies, permission.URN)
+	}
+
+	var prefixes []interface{}
+	for _, function := range notification.Outputs["lambdaFunctions"].([]interface{}) {
+		prefixes = append(prefixes, function.(map[string]interface{})["filterPrefix"])
+	}
+	assert.Contains(t, prefixes, uploadPrefix)
+}
+
+func resourcesOfType(stack integration.RuntimeValidationStackInfo, typ string) []apitype.ResourceV2 {
+	var resources []apitype.ResourceV2
+	for _, res := range stack.Deployment.Resources {
+		if string(res.Type) == typ {
+			resources = append(resources, res)
+		}
+	}
+	return resources
+}
+
+// resourceNamed returns the resource of type [typ] named [name] in [stack], failing the test if there isn't one.
+func resourceNamed(
+	t *testing.T, stack integration.RuntimeValidationStackInfo, typ string, name string) (apitype.ResourceV2, bool) {
+
+	for _, res := range resourcesOfType(stack, typ) {
+		if strings.HasSuffix(string(res.URN), "::"+name) {
+			return res, true
+		}
+	}
+	assert.Fail(t, fmt.Sprintf("expected a %v named %v", typ, name))
+	return apitype.ResourceV2{}, false
+}
+
+// assertHandlerReads asserts that the serialized handler of the function named [functionName] reads each of the event
+// [fields] given, which the program type checked against the event payload its handler is declared with.
+func assertHandlerReads(
+	t *testing.T, stack integration.RuntimeValidationStackInfo, functionName string, fields ...string) {
+
+	function, ok := resourceNamed(t, stack, "aws:lambda/function:Function", functionName)
+	if !ok {
+		return
+	}
+	code, err := json.Marshal(function.Inputs["code"])
+	if !assert.NoError(t, err) {
+		return
+	}
+	for _, field := range fields {
+		assert.Contains(t, string(code), field, "handler of %v", functionName)
+	}
+}
+
+// assertNoLogGroups asserts that no log group was created for any of the functions named [functionNames].
+func assertNoLogGroups(t *testing.T, stack integration.RuntimeValidationStackInfo, functionNames ...string) {
+	for _, logGroup := range resourcesOfType(stack, "aws:cloudwatch/logGroup:LogGroup") {
+		for _, functionName := range functionNames {
+			assert.NotContains(t, string(logGroup.URN), "::"+functionName, "log group of %v", functionName)
+		}
+	}
+}
+
+// attachedPolicies returns the ARNs of the managed policies attached to [role].
+func attachedPolicies(stack integration.RuntimeValidationStackInfo, role apitype.ResourceV2) []interface{} {
+	var arns []interface{}
+	for _, attachment := range resourcesOfType(stack, "aws:iam/rolePolicyAttachment:RolePolicyAttachment") {
+		if attachment.Outputs["role"] == role.Outputs["name"] {
+			arns = append(arns, attachment.Outputs["policyArn"])
+		}
+	}
+	return arns
+}
@@ -17,6 +17,9 @@ import * as serverless from "@pulumi/aws-serverless";
 import * as pulumi from "@pulumi/pulumi";
 import { Output } from "@pulumi/pulumi";
 
+// Give every handler below more headroom than Lambda's defaults, on a pinned runtime, running on Graviton.
+serverless.setDefaultFunctionOptions({ timeout: 30, runtime: "nodejs20.x", architecture: "arm64" });
+
 const bucket = new aws.s3.Bucket("testbucket", {
     serverSideEncryptionConfiguration: {
         rule: {
@@ -28,11 +31,11 @@ const bucket = new aws.s3.Bucket("testbucket", {
     forceDestroy: true,
 });
 
-serverless.bucket.onPut("test", bucket, async (event) => {
+serverless.bucket.onObjectCreated("test", bucket, async (event: serverless.bucket.BucketEvent) => {
     const awssdk = await import("aws-sdk");
     const s3 = new awssdk.S3();
 
-    const recordFile = "lastPutFile.json";
+    const recordFile = process.env.RECORD_FILE!;
 
     const records = event.Records || [];
     for (const record of records) {
@@ -53,4 +56,35 @@ serverless.bucket.onPut("test", bucket, async (event) => {
             }).promise();
         }
     }
+}, {
+    filterPrefix: "uploads/",
+    // The record file is written outside of uploads/, so this shouldn't warn.
+    skipPrefix: "lastPutFile.json",
+    memorySize: 256,
+    environment: { variables: { RECORD_FILE: "lastPutFile.json" } },
 });
+
+// Additional subscriptions on the same bucket are merged into its single notification configuration.
+serverless.bucket.onObjectCreated("thumbnails", bucket, async (event) => {
+    const records: serverless.bucket.BucketRecord[] = event.Records || [];
+    for (const record of records) {
+        console.log(`Thumbnail created in ${record.s3.bucket.arn}: ${record.s3.object.key}`);
+    }
+}, {
+    filterPrefix: "thumbnails/",
+    ephemeralStorageSize: 2048,
+    // The thumbnailer is pinned to x86_64 and given longer to run, overriding the defaults.
+    architecture: "x86_64",
+    timeout: 60,
+    // Resized copies are written alongside the originals, so this should warn that they still invoke the handler.
+    skipPrefix: "thumbnails/small/",
+});
+
+// The bucket's name is resolved before the handler is created, so it is used as a plain string.
+serverless.bucket.onObjectRemoved("removed", bucket, serverless.handlerFactory({ bucketName: bucket.id },
+    ({ bucketName }) => async (event: serverless.bucket.BucketEvent) => {
+        const records = event.Records || [];
+        for (const record of records) {
+            console.log(`Object removed from ${bucketName}: ${record.s3.object.key}`);
+        }
+    }));
@@ -0,0 +1,90 @@
+// Copyright 2016-2018, Pulumi Corporation.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+import * as aws from "@pulumi/aws";
+import * as serverless from "@pulumi/aws-serverless";
+import * as pulumi from "@pulumi/pulumi";
+import { Output } from "@pulumi/pulumi";
+
+// Give every handler below more headroom than Lambda's defaults, on a pinned runtime, running on Graviton.
+serverless.setDefaultFunctionOptions({ timeout: 30, runtime: "nodejs20.x", architecture: "arm64" });
+
+const bucket = new aws.s3.Bucket("testbucket", {
+    serverSideEncryptionConfiguration: {
+        rule: {
+            applyServerSideEncryptionByDefault: {
+                sseAlgorithm: "AES256",
+            },
+        },
+    },
+    forceDestroy: true,
+});
+
+serverless.bucket.onObjectCreated("test", bucket, async (event) => {
+    const awssdk = await import("aws-sdk");
+    const s3 = new awssdk.S3();
+
+    const recordFile = process.env.RECORD_FILE!;
+
+    const records = event.Records || [];
+    for (const record of records) {
+        const key = record.s3.object.key;
+
+        if (key !== recordFile) {
+            // Construct an event arguments object.
+            const args = {
+                key: record.s3.object.key,
+                size: record.s3.object.size,
+                eventTime: record.eventTime,
+            };
+
+            const res = await s3.putObject({
+                Bucket: bucket.id.get(),
+                Key: recordFile,
+                Body: JSON.stringify(args),
+            }).promise();
+        }
+    }
+}, {
+    // Moving the trigger from uploads/ should update the bucket's notification without conflicting with itself.
+    filterPrefix: "incoming/",
+    // The record file is written outside of incoming/, so this shouldn't warn.
+    skipPrefix: "lastPutFile.json",
+    memorySize: 256,
+    environment: { variables: { RECORD_FILE: "lastPutFile.json" } },
+});
+
+// Additional subscriptions on the same bucket are merged into its single notification configuration.
+serverless.bucket.onObjectCreated("thumbnails", bucket, async (event) => {
+    const records = event.Records || [];
+    for (const record of records) {
+        console.log(`Thumbnail created: ${record.s3.object.key}`);
+    }
+}, {
+    filterPrefix: "thumbnails/",
+    ephemeralStorageSize: 2048,
+    // The thumbnailer is pinned to x86_64, overriding the default.
+    architecture: "x86_64",
+    // Resized copies are written alongside the originals, so this should warn that they still invoke the handler.
+    skipPrefix: "thumbnails/small/",
+});
+
+// The bucket's name is resolved before the handler is created, so it is used as a plain string.
+serverless.bucket.onObjectRemoved("removed", bucket, serverless.handlerFactory({ bucketName: bucket.id },
+    ({ bucketName }) => async (event: serverless.bucket.BucketEvent) => {
+        const records = event.Records || [];
+        for (const record of records) {
+            console.log(`Object removed from ${bucketName}: ${record.s3.object.key}`);
+        }
+    }));
@@ -0,0 +1,29 @@
+// Copyright 2016-2018, Pulumi Corporation.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+
+import * as serverless from "@pulumi/aws-serverless";
+
+// Serve directory URLs from their index document before the request reaches the origin.
+const rewrite = serverless.cloudfront.onEvent("index-rewrite", { distributionEventType: "viewer-request" },
+    async (event) => {
+        const request = event.Records[0].cf.request;
+        if (request.uri.endsWith("/")) {
+            request.uri += "index.html";
+        }
+        return request;
+    });
+
+// Attach to a distribution's cache behavior with `lambdaFunctionAssociations: [rewrite.lambdaFunctionAssociation]`.
+export const rewriteArn = rewrite.qualifiedArn;
@@ -19,7 +19,7 @@ import { Output } from "@pulumi/pulumi";
 
 const topic = new aws.sns.Topic("topic", { });
 
-serverless.topic.subscribe("process-topic", topic, async (event) => {
+serverless.topic.subscribe("process-topic", topic, async (event: serverless.topic.SNSEvent) => {
     const awssdk = await import("aws-sdk");
 
     const records = event.Records || [];
@@ -30,7 +30,7 @@ serverless.topic.subscribe("process-topic", topic, async (event) => {
     }
 });
 
-serverless.cloudwatch.onEvent("hourly", "rate(60 minutes)", async (event) => {
+serverless.cloudwatch.onEvent("hourly", "rate(60 minutes)", async (event: serverless.cloudwatch.ScheduledEvent) => {
     const awssdk = await import("aws-sdk");
     const sns = new awssdk.SNS();
 
@@ -39,3 +39,47 @@ serverless.cloudwatch.onEvent("hourly", "rate(60 minutes)", async (event) => {
         TopicArn: topic.id.get(),
     }).promise();
 });
+
+// Report every weekday morning, local time, regardless of daylight saving.  The report can also be run on demand
+// through its function URL.
+const morningReport = serverless.timer.cron("morning-report", "0 9 ? * MON-FRI *", async (event) => {
+    console.log(`Morning report: ${JSON.stringify(event)}`);
+}, { timezone: "America/New_York", functionUrl: { authType: "NONE" } });
+
+export const morningReportUrl = morningReport.functionUrl;
+
+// Send a one-off reminder ahead of the service's planned retirement.
+serverless.timer.at("retirement-reminder", new Date("2035-01-01T09:00:00Z"), async (event) => {
+    console.log(`Retirement reminder: ${JSON.stringify(event)}`);
+});
+
+// Announce the launch at the time it is configured for, which has passed by the time the program is next deployed.
+const config = new pulumi.Config();
+serverless.timer.at("launch-announcement", new Date(config.require("announcementAt")), async (event) => {
+    console.log(`Launch announcement: ${JSON.stringify(event)}`);
+});
+
+// React to EC2 instances changing state.  The subscription's resources are all created with the provider given to it.
+const eventsProvider = new aws.Provider("events", { region: <aws.Region>aws.config.region });
+serverless.cloudwatch.onEvent("ec2-state-change", {
+    eventPattern: {
+        source: ["aws.ec2"],
+        "detail-type": ["EC2 Instance State-change Notification"],
+    },
+}, async (event: serverless.cloudwatch.CloudwatchEvent) => {
+    console.log(`${event["detail-type"]}: ${event.resources.join(", ")} is ${event.detail.state}`);
+}, undefined, { provider: eventsProvider });
+
+// Report errors logged by an application as they are written.
+const appLogs = new aws.cloudwatch.LogGroup("app-logs", { retentionInDays: 7 });
+serverless.cloudwatch.onLogEvent("app-errors", appLogs, async (event: serverless.cloudwatch.LogGroupEvent) => {
+    const zlib = await import("zlib");
+    const decoded: serverless.cloudwatch.DecodedLogGroupEvent =
+        JSON.parse(zlib.gunzipSync(Buffer.from(event.awslogs.data, "base64")).toString());
+    for (const logEvent of decoded.logEvents) {
+        console.log(`Error in ${decoded.logStream}: ${logEvent.message}`);
+    }
+}, { filterPattern: "ERROR" });
+
+export const appLogGroupName = appLogs.name;
+export const appLogGroupArn = appLogs.arn;
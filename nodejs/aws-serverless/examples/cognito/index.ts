@@ -0,0 +1,37 @@
+// Copyright 2016-2018, Pulumi Corporation.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+
+import * as serverless from "@pulumi/aws-serverless";
+
+const userPool = serverless.cognito.createUserPool("users", {
+    autoVerifiedAttributes: ["email"],
+});
+
+// Only allow sign ups from our own domain, and confirm them automatically.
+serverless.cognito.onPreSignUp("restrict-sign-up", userPool, async (event) => {
+    const email: string = event.request.userAttributes["email"] || "";
+    if (!email.endsWith("@example.com")) {
+        throw new Error("Sign ups are restricted to example.com accounts.");
+    }
+    event.response.autoConfirmUser = true;
+    return event;
+});
+
+serverless.cognito.onPostConfirmation("welcome", userPool, async (event) => {
+    console.log(`Welcome, ${event.userName}!`);
+    return event;
+});
+
+export const userPoolId = userPool.id;
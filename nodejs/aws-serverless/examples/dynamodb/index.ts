@@ -0,0 +1,55 @@
+// Copyright 2016-2018, Pulumi Corporation.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+import * as aws from "@pulumi/aws";
+import * as serverless from "@pulumi/aws-serverless";
+
+const table = new aws.dynamodb.Table("orders", {
+    attributes: [{ name: "id", type: "S" }],
+    hashKey: "id",
+    billingMode: "PAY_PER_REQUEST",
+    streamEnabled: true,
+    streamViewType: "NEW_IMAGE",
+});
+
+// Batches that still fail after being split and retried a few times, or that are over an hour old, are set aside in a
+// queue rather than blocking the rest of the stream.
+const failedOrders = new aws.sqs.Queue("failed-orders");
+
+async function processOrders(event: serverless.dynamodb.DynamoDBStreamEvent) {
+    // Only the records from the first one lacking a new image onwards are retried.
+    for (const record of event.Records) {
+        if (!record.dynamodb.NewImage) {
+            return { batchItemFailures: [{ itemIdentifier: record.dynamodb.SequenceNumber }] };
+        }
+        console.log(`New order ${JSON.stringify(record.dynamodb.Keys)}`);
+    }
+    return { batchItemFailures: [] };
+}
+
+// Gather new orders for a few seconds so that bursts of writes are handled together.  Updates and deletions are
+// filtered out before the function is invoked.
+const subscription = serverless.dynamodb.subscribe("process-orders", table, processOrders, {
+    startingPosition: "TRIM_HORIZON",
+    maximumBatchingWindowInSeconds: 10,
+    filterCriteria: { filters: [{ pattern: { eventName: ["INSERT"] } }] },
+    maximumRetryAttempts: 3,
+    maximumRecordAgeInSeconds: 3600,
+    bisectBatchOnFunctionError: true,
+    discardedBatchDestination: failedOrders.arn,
+    reportBatchItemFailures: true,
+});
+
+export const subscriptionMappingUuid = subscription.eventSourceMapping.uuid;
+export const failedOrdersArn = failedOrders.arn;
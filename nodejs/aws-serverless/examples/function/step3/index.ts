@@ -0,0 +1,121 @@
+// Copyright 2016-2018, Pulumi Corporation.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+import * as aws from "@pulumi/aws";
+import * as serverless from "@pulumi/aws-serverless";
+
+// Every resource created for the subscriptions below is tagged with the project it belongs to.
+serverless.setDefaultTags({ project: "serverless-function" });
+
+const topic = new aws.sns.Topic("events");
+
+// A role managed by the program itself, which the subscription runs as rather than creating its own.
+const role = new aws.iam.Role("shared-role", {
+    assumeRolePolicy: JSON.stringify({
+        Version: "2012-10-17",
+        Statement: [{
+            Action: "sts:AssumeRole",
+            Principal: { Service: "lambda.amazonaws.com" },
+            Effect: "Allow",
+        }],
+    }),
+});
+const roleAccess = new aws.iam.RolePolicyAttachment("shared-role-access", {
+    role: role,
+    policyArn: aws.iam.AWSLambdaFullAccess,
+});
+
+serverless.topic.subscribe("shared-role", topic, async (event) => {
+    console.log(`Received ${event.Records.length} messages`);
+}, { role: role.arn });
+
+// A function attached to a private subnet, able to reach resources only accessible from within the VPC.
+const vpc = new aws.ec2.Vpc("private", { cidrBlock: "10.0.0.0/16" });
+const subnet = new aws.ec2.Subnet("private", { vpcId: vpc.id, cidrBlock: "10.0.1.0/24" });
+const securityGroup = new aws.ec2.SecurityGroup("private", {
+    vpcId: vpc.id,
+    egress: [{ protocol: "-1", fromPort: 0, toPort: 0, cidrBlocks: ["0.0.0.0/0"] }],
+});
+
+serverless.topic.subscribe("in-vpc", topic, async (event) => {
+    console.log(`Received ${event.Records.length} messages`);
+}, {
+    vpcConfig: {
+        subnetIds: [subnet.id],
+        securityGroupIds: [securityGroup.id],
+    },
+});
+
+// Events the function fails to process, even after Lambda's retries, are kept in a queue for inspection.
+const failedEvents = new aws.sqs.Queue("failed-events");
+
+serverless.topic.subscribe("with-dead-letter-queue", topic, async (event) => {
+    console.log(`Received ${event.Records.length} messages`);
+}, { deadLetterConfig: { targetArn: failedEvents.arn } });
+
+// The results of asynchronous invocations are published for other services to act on, with failures set aside
+// alongside the events of the subscription above.
+const results = new aws.sns.Topic("results");
+serverless.topic.subscribe("with-destinations", topic, async (event) => {
+    return { processed: event.Records.length };
+}, { onSuccess: results.arn, onFailure: failedEvents.arn });
+
+// Logs of a chatty function are only kept for a week, rather than forever in the log group Lambda would create.
+serverless.topic.subscribe("short-lived-logs", topic, async (event) => {
+    console.log(`Received ${JSON.stringify(event)}`);
+}, { logRetentionInDays: 7 });
+
+// Invocations are traced with X-Ray.
+serverless.topic.subscribe("traced", topic, async (event) => {
+    console.log(`Received ${event.Records.length} messages`);
+}, { tracingConfig: { mode: "Active" } });
+
+// The resources created for this subscription, its log group among them, are also tagged with the team owning it.
+serverless.topic.subscribe("tagged", topic, async (event) => {
+    console.log(`Received ${event.Records.length} messages`);
+}, { tags: { team: "billing" }, logRetentionInDays: 14 });
+
+// Orders are processed by a function kept warm so that they are handled without cold starts, and whose reserved
+// concurrency keeps it from starving the account's other functions.
+const orders = new aws.sqs.Queue("orders");
+const ordersSubscription = serverless.queue.subscribe("warm", orders, async (event) => {
+    console.log(`Received ${event.Records.length} orders`);
+}, { reservedConcurrentExecutions: 5, provisionedConcurrentExecutions: 1 });
+
+// Audit records are handled by a function whose role may only write its logs and read the queue it is subscribed to.
+const audits = new aws.sqs.Queue("audits");
+serverless.queue.subscribe("least-privilege", audits, async (event) => {
+    console.log(`Received ${event.Records.length} audit records`);
+}, { leastPrivilegeLogging: true });
+
+// A function called directly over HTTPS, whose log group is left for Lambda to create as it always has been.  Having
+// been called, it now has one, which updating the function must leave alone.
+const publicSubscription = serverless.topic.subscribe("public", topic, async (event) => {
+    console.log(`Received a request for ${JSON.stringify(event)}`);
+}, { functionUrl: { authType: "NONE" }, timeout: 10 });
+
+// Events can't be sent on to a subnet, so this update should be rejected even though the subscription runs as the
+// shared role rather than one created to deliver them.
+serverless.topic.subscribe("misdirected-dead-letters", topic, async (event) => {
+    console.log(`Received ${event.Records.length} messages`);
+}, { role: role.arn, deadLetterConfig: { targetArn: subnet.arn } });
+
+export const sharedRoleArn = role.arn;
+export const subnetId = subnet.id;
+export const securityGroupId = securityGroup.id;
+export const failedEventsArn = failedEvents.arn;
+export const warmMappingUuid = ordersSubscription.eventSourceMapping.uuid;
+export const resultsArn = results.arn;
+export const auditsArn = audits.arn;
+export const publicUrl = publicSubscription.functionUrl;
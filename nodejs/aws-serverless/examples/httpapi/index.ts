@@ -0,0 +1,46 @@
+// Copyright 2016-2018, Pulumi Corporation.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+
+import * as aws from "@pulumi/aws";
+import * as serverless from "@pulumi/aws-serverless";
+
+// An existing function can be routed to just like an inline handler.
+const getItem = new aws.lambda.CallbackFunction("get-item", {
+    callback: async (event: serverless.apigateway.Request) => {
+        return {
+            statusCode: 200,
+            body: JSON.stringify({ id: event.pathParameters["id"] }),
+        };
+    },
+});
+
+const api = serverless.apigateway.httpApi("myhttpapi", {
+    routes: [
+        { method: "GET", path: "/items", handler: async (event) => {
+            return {
+                statusCode: 200,
+                body: "Hello, world!",
+            };
+        }},
+        { method: "GET", path: "/items/{id}", handler: getItem },
+    ],
+    cors: {
+        allowOrigins: ["https://example.com", "https://www.example.com"],
+        allowMethods: ["GET"],
+        maxAge: 600,
+    },
+});
+
+export const url = api.url;
@@ -0,0 +1,39 @@
+// Copyright 2016-2018, Pulumi Corporation.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+
+import * as aws from "@pulumi/aws";
+import * as serverless from "@pulumi/aws-serverless";
+
+const stream = new aws.kinesis.Stream("clicks", {
+    shardCount: 1,
+});
+
+// Read through a dedicated consumer so this subscription doesn't compete with other readers of the stream, gathering
+// clicks for up to five seconds at a time.
+serverless.kinesis.subscribe("count-clicks", stream, async (event: serverless.kinesis.KinesisStreamEvent) => {
+    for (const record of event.Records) {
+        const data = Buffer.from(record.kinesis.data, "base64").toString();
+        console.log(`Click: ${data}`);
+    }
+}, { enhancedFanOut: true, startingPosition: "TRIM_HORIZON", maximumBatchingWindowInSeconds: 5 });
+
+// Keep a running count of clicks per minute, passing the count between invocations within each window.
+serverless.kinesis.subscribe("clicks-per-minute", stream, async (event: serverless.kinesis.StreamWindowEvent) => {
+    const count = (event.state["count"] || 0) + event.Records.length;
+    if (event.isFinalInvokeForWindow) {
+        console.log(`${count} clicks between ${event.window.start} and ${event.window.end}`);
+    }
+    return { state: { count: count } };
+}, { tumblingWindowInSeconds: 60 });
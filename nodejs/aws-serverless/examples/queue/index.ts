@@ -26,11 +26,21 @@ const bucket = new aws.s3.Bucket("testbucket", {
     forceDestroy: true,
 });
 
-const sqsQueue = new aws.sqs.Queue("queue", {
-    visibilityTimeoutSeconds: 300,
+// The queue's visibility timeout is derived from the timeout of the handler subscribed to it below.  Messages the
+// handler fails to process three times are set aside in a dead-letter queue created alongside it.
+const handlerTimeout = 45;
+const sqsQueue = serverless.queue.createQueue("queue", {
+    handlerTimeout: handlerTimeout,
+    deadLetterQueue: { maxReceiveCount: 3 },
 });
 
-serverless.queue.subscribe("subscription", sqsQueue, async (event) => {
+const table = new aws.dynamodb.Table("events", {
+    attributes: [{ name: "id", type: "S" }],
+    hashKey: "id",
+    billingMode: "PAY_PER_REQUEST",
+});
+
+const subscription = serverless.queue.subscribe("subscription", sqsQueue, async (event: serverless.queue.SQSEvent) => {
     const awssdk = await import("aws-sdk");
     const s3 = new awssdk.S3();
 
@@ -43,7 +53,49 @@ serverless.queue.subscribe("subscription", sqsQueue, async (event) => {
         Body: JSON.stringify(event),
     }).promise();
     console.log("Stored sqs message to S3.");
-}, { batchSize: 1 });
+
+    const dynamo = new awssdk.DynamoDB.DocumentClient();
+    for (const record of event.Records) {
+        await dynamo.put({
+            TableName: table.name.get(),
+            Item: { id: record.messageId, body: record.body },
+        }).promise();
+    }
+}, {
+    batchSize: 1,
+    maximumBatchingWindowInSeconds: 1,
+    timeout: handlerTimeout,
+    enforceVisibilityTimeout: true,
+    // Leave capacity in the table for the queue's other consumers.
+    maximumConcurrency: 5,
+    // Grant access to exactly the resources the handler uses.
+    policies: ["arn:aws:iam::aws:policy/AmazonS3FullAccess"],
+    inlinePolicy: table.arn.apply(arn => ({
+        Version: "2012-10-17",
+        Statement: [{
+            Effect: "Allow",
+            Action: "dynamodb:PutItem",
+            Resource: arn,
+        }],
+    })),
+});
+
+// Reuse the function created above to also store messages published to a topic.
+const topic = new aws.sns.Topic("topic");
+serverless.topic.subscribe("topic-subscription", topic, subscription.func);
+
+// Fan a second topic out to the queue, delivering its messages as published.
+const ordersTopic = new aws.sns.Topic("orders");
+serverless.topic.subscribeQueue("orders-to-queue", ordersTopic, sqsQueue, { rawMessageDelivery: true });
+
+// Returns are fanned out to the same queue, whose policy allows both topics to send to it.
+const returnsTopic = new aws.sns.Topic("returns");
+serverless.topic.subscribeQueue("returns-to-queue", returnsTopic, sqsQueue, { rawMessageDelivery: true });
 
 export const queueUrl = sqsQueue.id;
 export const bucketUrl = bucket.id.apply(id => `s3://${id}`);
+
+// The resources created for the subscription are exposed for further configuration.
+export const subscriptionFunctionArn = subscription.func.arn;
+export const subscriptionRoleArn = subscription.role && subscription.role.arn;
+export const subscriptionMappingUuid = subscription.eventSourceMapping.uuid;
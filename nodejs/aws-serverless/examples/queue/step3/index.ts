@@ -0,0 +1,26 @@
+// Copyright 2016-2018, Pulumi Corporation.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+
+import * as aws from "@pulumi/aws";
+import * as serverless from "@pulumi/aws-serverless";
+
+const sqsQueue = new aws.sqs.Queue("queue", {
+    visibilityTimeoutSeconds: 300,
+});
+
+// Batches of more than 10 messages need a batching window, so this update should be rejected.
+serverless.queue.subscribe("subscription", sqsQueue, async (event) => {
+    console.log(`Received ${event.Records.length} messages`);
+}, { batchSize: 100 });
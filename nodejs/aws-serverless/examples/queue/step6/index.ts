@@ -0,0 +1,39 @@
+// Copyright 2016-2018, Pulumi Corporation.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+
+import * as serverless from "@pulumi/aws-serverless";
+
+// Orders are processed in the order they were placed, with those that repeatedly fail moved to a FIFO dead-letter
+// queue created alongside the queue.  Only the orders that fail are retried, rather than the whole batch.
+const orders = serverless.queue.createQueue("orders", {
+    fifo: true,
+    deadLetterQueue: { maxReceiveCount: 5 },
+});
+
+// Each message received from a FIFO queue carries the group it was sent in, within which orders stay in sequence.
+serverless.queue.subscribe("process-orders", orders, async (event: serverless.queue.SQSEvent) => {
+    const failures: { itemIdentifier: string }[] = [];
+    for (const record of event.Records) {
+        try {
+            const order = JSON.parse(record.body);
+            console.log(`Order ${JSON.stringify(order)} in group ${record.attributes.MessageGroupId}`);
+        } catch (err) {
+            failures.push({ itemIdentifier: record.messageId });
+        }
+    }
+    return { batchItemFailures: failures };
+}, { batchSize: 10, reportBatchItemFailures: true });
+
+export const ordersArn = orders.arn;
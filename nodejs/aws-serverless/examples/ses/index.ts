@@ -0,0 +1,35 @@
+// Copyright 2016-2018, Pulumi Corporation.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+
+import * as aws from "@pulumi/aws";
+import * as serverless from "@pulumi/aws-serverless";
+
+const ruleSet = new aws.ses.ReceiptRuleSet("inbound", {
+    ruleSetName: "serverless-example-inbound",
+});
+
+serverless.ses.onEmailReceived("support", {
+    ruleSetName: ruleSet.ruleSetName,
+    recipients: ["support@example.com"],
+    scanEnabled: true,
+}, async (event) => {
+    for (const record of event.Records) {
+        const mail = record.ses.mail;
+        console.log(`Email from ${mail.source}: ${mail.commonHeaders.subject}`);
+    }
+}, {
+    // The handler only logs what it receives, so its role needs no more than to write to its log group.
+    leastPrivilegeLogging: true,
+});
@@ -0,0 +1,41 @@
+// Copyright 2016-2018, Pulumi Corporation.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+
+import * as serverless from "@pulumi/aws-serverless";
+
+// Each task state is run by the handler of the same name.
+const workflow = serverless.stepfunctions.stateMachine("order-workflow", {
+    definition: {
+        StartAt: "Validate",
+        States: {
+            Validate: { Type: "Task", Next: "Charge" },
+            Charge: { Type: "Task", End: true },
+        },
+    },
+    handlers: {
+        Validate: async (order: { id: string; amount: number }) => {
+            if (order.amount <= 0) {
+                throw new Error(`Order ${order.id} has no amount to charge.`);
+            }
+            return order;
+        },
+        Charge: async (order: { id: string; amount: number }) => {
+            console.log(`Charging ${order.amount} for order ${order.id}`);
+            return { ...order, charged: true };
+        },
+    },
+});
+
+export const stateMachineArn = workflow.stateMachine.id;
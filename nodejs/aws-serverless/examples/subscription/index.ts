@@ -0,0 +1,45 @@
+// Copyright 2016-2018, Pulumi Corporation.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+
+import * as aws from "@pulumi/aws";
+import * as serverless from "@pulumi/aws-serverless";
+
+const orders = new aws.sqs.Queue("orders");
+const refunds = new aws.sqs.Queue("refunds");
+const audits = new aws.sns.Topic("audits");
+
+// One function records the events from every source, rather than a function being created for each.
+serverless.subscription.subscribeAll("ledger", [
+    { type: "sqs", queue: orders, args: { batchSize: 5 } },
+    { type: "sqs", queue: refunds },
+    { type: "sns", topic: audits },
+], async (event) => {
+    for (const record of event.Records) {
+        console.log(`Ledger entry: ${JSON.stringify(record)}`);
+    }
+}, { memorySize: 256 });
+
+// Payments are reconciled by a function whose role may only write its logs and receive the messages of the queue it
+// reads from.
+const payments = new aws.sqs.Queue("payments");
+const chargebacks = new aws.sns.Topic("chargebacks");
+serverless.subscription.subscribeAll("reconciler", [
+    { type: "sqs", queue: payments },
+    { type: "sns", topic: chargebacks },
+], async (event) => {
+    console.log(`Reconciling ${event.Records.length} records`);
+}, { leastPrivilegeLogging: true });
+
+export const paymentsArn = payments.arn;
@@ -14,10 +14,20 @@
 
 import * as aws from "@pulumi/aws";
 import * as serverless from "@pulumi/aws-serverless";
+import * as pulumi from "@pulumi/pulumi";
 
 const topic = new aws.sns.Topic("sites-to-process-topic", { });
 
-serverless.topic.subscribe("for-each-url", topic, async (event) => {
+// Layers share code between functions without including it in each one's deployment package.
+const layers = ["config", "logging"].map(layerName => new aws.lambda.LayerVersion(layerName, {
+    layerName: "serverless-example-" + layerName,
+    compatibleRuntimes: [aws.lambda.NodeJS8d10Runtime],
+    code: new pulumi.asset.AssetArchive({
+        [`nodejs/node_modules/${layerName}/index.js`]: new pulumi.asset.StringAsset("module.exports = {};"),
+    }),
+}));
+
+serverless.topic.subscribe("for-each-url", topic, async (event: serverless.topic.SNSEvent) => {
     const fetch = (await import("node-fetch")).default;
 
     const records = event.Records || [];
@@ -36,3 +46,35 @@ serverless.topic.subscribe("for-each-url", topic, async (event) => {
         }
     }
 });
+
+// Messages that can't be delivered to the order handler are kept in a dead-letter queue for inspection.
+const orderFailures = new aws.sqs.Queue("order-created-failures");
+
+// Only messages published with an `eventType` attribute of "order_created" are delivered to this handler.
+const orderCreated = serverless.topic.subscribe("order-created", topic, async (event: serverless.topic.SNSEvent) => {
+    const records = event.Records || [];
+    for (const record of records) {
+        const eventType: serverless.topic.SNSMessageAttribute = record.Sns.MessageAttributes["eventType"];
+        console.log(`Order created (${eventType.Value}): ${record.Sns.Message}`);
+    }
+}, {
+    filterPolicy: { eventType: ["order_created"] },
+    redrivePolicy: { deadLetterTargetArn: orderFailures.arn },
+    layers: layers.map(layer => layer.arn),
+});
+
+// Shipments published to a topic of their own share the dead-letter queue, whose policy allows both topics to send.
+const shipments = new aws.sns.Topic("shipments");
+serverless.topic.subscribe("order-shipped", shipments, async (event: serverless.topic.TopicEvent) => {
+    for (const record of event.Records || []) {
+        console.log(`Order shipped: ${record.Sns.Subject || record.Sns.Message}`);
+    }
+}, { redrivePolicy: { deadLetterTargetArn: orderFailures.arn } });
+
+// Notify the on-call topic whenever order handling fails or is throttled.
+const alarmTopic = new aws.sns.Topic("order-alarms");
+orderCreated.addAlarms({
+    topicArn: alarmTopic.arn,
+    errors: { threshold: 5, period: 300 },
+    throttles: true,
+});
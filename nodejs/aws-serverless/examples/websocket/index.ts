@@ -0,0 +1,31 @@
+// Copyright 2016-2018, Pulumi Corporation.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+
+import * as serverless from "@pulumi/aws-serverless";
+
+const api = serverless.apigateway.websocketApi("mywebsocketapi", {
+    routes: [
+        { routeKey: "$connect", handler: async (event) => {
+            console.log(`Connected: ${event.requestContext.connectionId}`);
+            return { statusCode: 200 };
+        }},
+        { routeKey: "sendMessage", handler: async (event) => {
+            console.log(`Message from ${event.requestContext.connectionId}: ${event.body}`);
+            return { statusCode: 200 };
+        }},
+    ],
+});
+
+export const url = api.url;
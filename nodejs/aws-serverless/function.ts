@@ -17,19 +17,908 @@ import * as pulumi from "@pulumi/pulumi";
 import * as aws from "@pulumi/aws";
 import { ResourceOptions } from "@pulumi/pulumi";
 
+import { mergeTags, sha1hash } from "./utils";
+
 /** @deprecated Use [lambda.Callback] instead. */
 export type Callback<E, R> = aws.lambda.Callback<E, R>;
 
-/** @deprecated Use [lambda.EventHandler] instead. */
-export type Handler<E, R> = aws.lambda.EventHandler<E, R>;
+/**
+ * Handler for an event subscription.  Either a callback, which is serialized into a new aws.lambda.Function, a
+ * [HandlerFactory] creating the callback from other resources' outputs, an existing aws.lambda.Function, or the ARN
+ * of an existing function.
+ */
+export type Handler<E, R> = aws.lambda.EventHandler<E, R> | HandlerFactory<E, R> | pulumi.Input<string>;
+
+/**
+ * A handler whose callback is created by [factory] from the values of [captures].  See [handlerFactory].
+ */
+export class HandlerFactory<E, R> {
+    public constructor(
+        public readonly captures: pulumi.Input<Record<string, any>>,
+        public readonly factory: (resolved: any) => aws.lambda.Callback<E, R>) {
+    }
+}
+
+/**
+ * handlerFactory returns a handler whose callback is created by [factory] from the values of [captures], i.e.
+ * `handlerFactory({ tableName: table.name }, ({ tableName }) => async (event) => { ... })`.  This lets a handler use
+ * other resources' outputs as plain values rather than calling .get() on them.  The resolved values are embedded in
+ * the function's code, and [factory] is called once each time the function starts.
+ */
+export function handlerFactory<C extends Record<string, pulumi.Input<any>>, E, R>(
+    captures: C, factory: (resolved: pulumi.Unwrap<C>) => aws.lambda.Callback<E, R>): HandlerFactory<E, R> {
+
+    return new HandlerFactory<E, R>(captures, factory);
+}
 
 const defaultComputePolicies = [
     aws.iam.AWSLambdaFullAccess,                 // Provides wide access to "serverless" services (Dynamo, S3, etc.)
 ];
 
+const lambdaRolePolicy = {
+    "Version": "2012-10-17",
+    "Statement": [
+        {
+            "Action": "sts:AssumeRole",
+            "Principal": {
+                "Service": "lambda.amazonaws.com",
+            },
+            "Effect": "Allow",
+            "Sid": "",
+        },
+    ],
+};
+
+/**
+ * Account-wide defaults for the Lambda functions created by this package.  See [setDefaultFunctionOptions].
+ */
+export interface FunctionDefaults {
+    /**
+     * Amount of memory in MB the function can use at runtime.  Defaults to 128.
+     */
+    memorySize?: pulumi.Input<number>;
+
+    /**
+     * The amount of time, in seconds, the function is allowed to run.  Defaults to 180 for handlers serialized from
+     * callbacks, and to Lambda's default of 3 for functions created with [fromAsset].
+     */
+    timeout?: pulumi.Input<number>;
+
+    /**
+     * The number of days to retain the function's logs for, or 0 to retain them forever.  When set, the function's
+     * log group is created along with it; otherwise Lambda creates the group itself the first time the function runs,
+     * retaining logs forever.  A function that has already run has a group, so before setting this for it, adopt the
+     * group into the stack under the name of the function's resource, i.e. with `pulumi import
+     * aws:cloudwatch/logGroup:LogGroup <resource name> /aws/lambda/<function name>`.  This is not an Input as it
+     * determines whether the log group is created.
+     */
+    logRetentionInDays?: number;
+
+    /**
+     * The Node.js runtime the function runs on, i.e. "nodejs22.x".  Handlers are serialized as JavaScript, so only
+     * Node.js runtimes are supported.  Defaults to "nodejs20.x".
+     */
+    runtime?: pulumi.Input<string>;
+
+    /**
+     * The instruction set the function runs on.  Defaults to "x86_64".  Handlers serialized from callbacks run on
+     * either, so a default set with [setDefaultFunctionOptions] applies to them, but functions created with
+     * [fromAsset] may be compiled for one, so only run on "arm64" when it is set for them explicitly.  Lambda@Edge
+     * functions only run on "x86_64".
+     */
+    architecture?: "x86_64" | "arm64";
+}
+
+let functionDefaults: FunctionDefaults = {};
+
+/**
+ * setDefaultFunctionOptions sets the options used for every function subsequently created by this package, unless
+ * overridden by the arguments passed to an individual subscription.
+ */
+export function setDefaultFunctionOptions(defaults: FunctionDefaults) {
+    functionDefaults = { ...defaults };
+}
+
+/**
+ * Options for the Lambda functions created on the caller's behalf by the helpers in this package.  These are ignored
+ * when an existing aws.lambda.Function is supplied as the handler.
+ */
+export interface FunctionArgs extends FunctionDefaults {
+    /**
+     * An existing IAM role, or the ARN of one, for the function to execute as.  When supplied, no role or policy
+     * attachments are created for the function.
+     */
+    role?: aws.iam.Role | pulumi.Input<string>;
+
+    /**
+     * Environment variables to make available to the function at runtime.  Useful for configuration that isn't known
+     * until deployment, such as values resolved from secrets, rather than captured in the handler's closure.
+     */
+    environment?: pulumi.Input<{ variables: Record<string, pulumi.Input<string>> }>;
+
+    /**
+     * The subnets and security groups of the VPC the function should run in, allowing it to reach private resources
+     * such as RDS or ElastiCache instances.  When the role is created on the caller's behalf it is also granted
+     * AWSLambdaVPCAccessExecutionRole.
+     */
+    vpcConfig?: pulumi.Input<{
+        subnetIds: pulumi.Input<string>[];
+        securityGroupIds: pulumi.Input<string>[];
+    }>;
+
+    /**
+     * An SQS queue or SNS topic to send events to once the function has failed to process them asynchronously.  When
+     * the role is created on the caller's behalf it is also granted permission to deliver to the target.
+     */
+    deadLetterConfig?: pulumi.Input<{ targetArn: pulumi.Input<string> }>;
+
+    /**
+     * The X-Ray tracing mode for the function.  When "Active" and the role is created on the caller's behalf, it is
+     * also granted AWSXRayDaemonWriteAccess.  This is not an Input as the mode determines which resources are created.
+     */
+    tracingConfig?: { mode: "Active" | "PassThrough" };
+
+    /**
+     * The ARN of an SQS queue, SNS topic, EventBridge event bus or Lambda function to send the result of successful
+     * asynchronous invocations to.  When the role is created on the caller's behalf it is also granted permission to
+     * deliver to the destination.
+     */
+    onSuccess?: pulumi.Input<string>;
+
+    /**
+     * The ARN of an SQS queue, SNS topic, EventBridge event bus or Lambda function to send the details of failed
+     * asynchronous invocations to.  When the role is created on the caller's behalf it is also granted permission to
+     * deliver to the destination.
+     */
+    onFailure?: pulumi.Input<string>;
+
+    /**
+     * Tags to apply to the function and every other taggable resource created for it, in addition to any set with
+     * [setDefaultTags].
+     */
+    tags?: pulumi.Input<Record<string, pulumi.Input<string>>>;
+
+    /**
+     * The amount of the account's concurrency reserved for this function, which also caps how far it can scale out.
+     */
+    reservedConcurrentExecutions?: pulumi.Input<number>;
+
+    /**
+     * The number of execution environments to keep initialized for the function.  When set, a version of the function
+     * is published along with a "live" alias for it, and events are delivered to the alias.
+     */
+    provisionedConcurrentExecutions?: pulumi.Input<number>;
+
+    /**
+     * Creates an HTTPS endpoint that invokes the function directly, without an API Gateway in front of it.  With an
+     * authType of "NONE" anyone may call the URL; with "AWS_IAM" callers must sign their requests.
+     */
+    functionUrl?: FunctionUrlArgs;
+
+    /**
+     * The amount of space, in MB, available to the function in /tmp.  Must be between 512 (the default) and 10240.
+     */
+    ephemeralStorageSize?: pulumi.Input<number>;
+
+    /**
+     * The ARNs of up to five layers to make available to the function, i.e. to share large dependencies between
+     * functions without including them in each one's deployment package.
+     */
+    layers?: pulumi.Input<pulumi.Input<string>[]>;
+
+    /**
+     * The ARNs of additional managed policies to attach to the role created for the function.  Ignored when [role]
+     * is supplied.  This is not an Input as the number of policies determines the attachments created.
+     */
+    policies?: pulumi.Input<string>[];
+
+    /**
+     * An additional policy document to add to the role created for the function, i.e. to grant access to specific
+     * resources.  Ignored when [role] is supplied.
+     */
+    inlinePolicy?: pulumi.Input<aws.iam.PolicyDocument>;
+
+    /**
+     * Whether to grant the role created for the function only the right to write to its own log group, in place of
+     * the broad managed policy attached by default.  Subscriptions polling a queue or stream also grant the role the
+     * right to read from it, but any other access the handler needs must then be granted with [policies] or
+     * [inlinePolicy].  The role may also create the function's log group, unless [logRetentionInDays] is set and the
+     * group is created along with the function.  Ignored when [role] is supplied.  This is not an Input as it
+     * determines which resources are created.
+     */
+    leastPrivilegeLogging?: boolean;
+
+    /**
+     * An explicit name for the function, in place of one generated from the subscription's name.  Names must be
+     * unique within an account and region, so a program setting one can't be deployed to several stacks there.
+     */
+    functionName?: pulumi.Input<string>;
+
+    /**
+     * An explicit name for the role created for the function, in place of a generated one.  Role names must be unique
+     * within an account, so a program setting one can't be deployed to several stacks in it.  Ignored when [role] is
+     * supplied.
+     */
+    roleName?: pulumi.Input<string>;
+}
+
+export interface FunctionUrlArgs {
+    authType: "NONE" | "AWS_IAM";
+
+    /**
+     * CORS settings for browsers calling the URL from other origins.
+     */
+    cors?: pulumi.Input<{
+        allowOrigins?: pulumi.Input<string>[];
+        allowMethods?: pulumi.Input<string>[];
+        allowHeaders?: pulumi.Input<string>[];
+        exposeHeaders?: pulumi.Input<string>[];
+        allowCredentials?: pulumi.Input<boolean>;
+        maxAge?: pulumi.Input<number>;
+    }>;
+}
+
+/**
+ * The resources backing a subscription's handler, as returned by [createFunction].
+ */
+export interface FunctionResources {
+    func: aws.lambda.Function;
+
+    /**
+     * The role created for the function, unless an existing function or role was supplied.
+     */
+    role?: aws.iam.Role;
+
+    /**
+     * The alias events are delivered to, created when provisioned concurrency is configured.
+     */
+    alias?: aws.lambda.Alias;
+
+    /**
+     * The function's URL, created when [FunctionArgs.functionUrl] is set.
+     */
+    functionUrl?: aws.lambda.FunctionUrl;
+
+    /**
+     * The function's log group, created when [FunctionArgs.logRetentionInDays] is set.
+     */
+    logGroup?: aws.cloudwatch.LogGroup;
+
+    /**
+     * The policy allowing the function's role to write its logs, created when [FunctionArgs.leastPrivilegeLogging]
+     * is set.
+     */
+    loggingPolicy?: aws.iam.RolePolicy;
+
+    /**
+     * The ARN that event sources should invoke: the alias's when there is one, otherwise the function's.
+     */
+    targetArn: pulumi.Output<string>;
+}
+
+/**
+ * What a function handles, which errors about its handler are reported against: i.e. the subscription named
+ * [subscription] to a topic has a [source] of "topic".
+ */
+export interface FunctionSource {
+    subscription: string;
+    source: string;
+}
+
+/**
+ * createFunction returns the aws.lambda.Function to use for [handler].  If [handler] is already a Function it is
+ * returned as is, and if it is an ARN the existing function is looked up.  Otherwise the callback is serialized into
+ * a new Function, running as either [args.role] or a new role created for it.
+ */
+export function createFunction<E, R>(
+    name: string, source: FunctionSource, handler: Handler<E, R>, args?: FunctionArgs,
+    opts?: ResourceOptions): FunctionResources {
+
+    if (handler instanceof HandlerFactory) {
+        const code = serializeHandler(source, resolvedCallbackFactory(handler), true);
+        const factoryRuntime = checkRuntime(name, withDefault(args && args.runtime, functionDefaults.runtime));
+        return createFunctionResources(name, args || {}, opts, common => createCallbackFunction(name, {
+            ...common,
+            architectures: callbackArchitectures(args),
+        }, code, factoryRuntime, opts));
+    }
+
+    if (typeof handler !== "function") {
+        const existing = handler instanceof aws.lambda.Function
+            ? handler
+            : aws.lambda.Function.get(name, handler, undefined, opts);
+        return { func: existing, targetArn: existing.arn };
+    }
+
+    const callbackCode = serializeHandler(source, handler, false);
+    const runtime = checkRuntime(name, withDefault(args && args.runtime, functionDefaults.runtime));
+    return createFunctionResources(name, args || {}, opts, common => createCallbackFunction(name, {
+        ...common,
+        architectures: callbackArchitectures(args),
+    }, callbackCode, runtime, opts));
+}
+
+// callbackArchitectures returns the architectures of a function serialized from a callback, falling back to the
+// package default as the callback runs on either.
+function callbackArchitectures(args: FunctionArgs | undefined): string[] | undefined {
+    const architecture = withDefault(args && args.architecture, functionDefaults.architecture);
+    return architecture !== undefined ? [architecture] : undefined;
+}
+
+// resolvedCallbackFactory returns the callbackFactory for [handler]'s function, calling its factory with the values
+// of its captures.  Outputs captured by a serialized closure are serialized as their values, so only the resolved
+// captures and the factory itself end up in the function's code.
+function resolvedCallbackFactory<E, R>(handler: HandlerFactory<E, R>): () => aws.lambda.Callback<E, R> {
+    const resolved = pulumi.output(handler.captures);
+    const factory = handler.factory;
+    return () => factory(resolved.get());
+}
+
+// The module a handler is serialized into, and the name it is exported under.
+const serializedModule = "__index";
+const serializedExport = "handler";
+
+// serializeHandler returns the code of a function running [handler], along with the packages it may require, failing
+// with an error naming [source] if the handler can't be serialized.  The serializer's own error only describes the
+// closure it was walking, which in a large program rarely points to the subscription at fault.  [isFactoryFunction]
+// is set when [handler] returns the callback to run rather than being it.
+function serializeHandler(source: FunctionSource, handler: Function, isFactoryFunction: boolean): pulumi.asset.Archive {
+    const serialized = pulumi.runtime.serializeFunction(handler, {
+        exportName: serializedExport,
+        isFactoryFunction: isFactoryFunction,
+    }).catch(err => {
+        const message = err && err.message || String(err);
+        const captured = /variable '([^']+)'/.exec(message);
+        throw new Error(
+            `The handler for subscription '${source.subscription}' (${source.source} events) could not be ` +
+            `serialized` + (captured ? `, as it captures '${captured[1]}'.  ` : `.  `) +
+            `Values like connections and circular structures can't be captured by a handler; ` +
+            `create them inside it instead.\n${message}`);
+    });
+
+    return new pulumi.asset.AssetArchive(serialized.then(async closure => {
+        const assets: pulumi.asset.AssetMap = {};
+        for (const [path, asset] of await pulumi.runtime.computeCodePaths()) {
+            assets[path] = asset;
+        }
+        assets[serializedModule + ".js"] = new pulumi.asset.StringAsset(closure.text);
+        return assets;
+    }));
+}
+
+// The runtime and timeout of functions serialized from callbacks that don't set their own.  Functions serialized from
+// callbacks have always been given this timeout by default, so existing stacks' functions already have it.
+const defaultCallbackRuntime = "nodejs20.x";
+const defaultCallbackTimeout = 180;
+
+// createCallbackFunction creates the function running [code], serialized by [serializeHandler].
+function createCallbackFunction(
+    name: string, common: CommonFunctionArgs, code: pulumi.asset.Archive, runtime: pulumi.Input<string> | undefined,
+    opts: ResourceOptions | undefined): aws.lambda.Function {
+
+    return new aws.lambda.Function(name, {
+        ...common,
+        role: common.role instanceof aws.iam.Role ? common.role.arn : common.role,
+        code: code,
+        handler: serializedModule + "." + serializedExport,
+        runtime: runtime !== undefined ? runtime : defaultCallbackRuntime,
+        timeout: common.timeout !== undefined ? common.timeout : defaultCallbackTimeout,
+    }, opts);
+}
+
+/**
+ * The code for a function created with [fromAsset]: either a local archive, or a zip file already uploaded to S3.
+ */
+export type FunctionCode = pulumi.asset.Archive | {
+    bucket: pulumi.Input<string>;
+    key: pulumi.Input<string>;
+    version?: pulumi.Input<string>;
+};
+
+export interface AssetFunctionArgs {
+    /**
+     * The function's code, i.e. a pulumi.asset.FileArchive of a zip file produced by a bundler.
+     */
+    code: FunctionCode;
+
+    /**
+     * The function's entry point within [code], i.e. "index.handler".  Defaults to "bootstrap" for the custom
+     * runtimes, and must be given for any other.
+     */
+    handler?: pulumi.Input<string>;
+
+    /**
+     * The runtime the function runs on.  Unlike functions created from callbacks, this may be any runtime Lambda
+     * supports, including the custom runtimes ("provided.al2" and "provided.al2023") used for compiled binaries.
+     */
+    runtime: pulumi.Input<string>;
+}
+
+/**
+ * fromAsset creates a function from prebuilt code rather than a callback, configured with the same [args] as the
+ * functions created for callbacks.  The result can be passed as the handler of any subscription.
+ */
+export function fromAsset(
+    name: string, asset: AssetFunctionArgs, args?: FunctionArgs, opts?: ResourceOptions): aws.lambda.Function {
+
+    const code = asset.code;
+    const handler = asset.handler !== undefined ? asset.handler : defaultAssetHandler(name, asset.runtime);
+    return createFunctionResources(name, args || {}, opts, common => new aws.lambda.Function(name, {
+        ...common,
+        role: common.role instanceof aws.iam.Role ? common.role.arn : common.role,
+        handler: handler,
+        runtime: asset.runtime,
+        code: code instanceof pulumi.asset.Archive ? code : undefined,
+        s3Bucket: code instanceof pulumi.asset.Archive ? undefined : code.bucket,
+        s3Key: code instanceof pulumi.asset.Archive ? undefined : code.key,
+        s3ObjectVersion: code instanceof pulumi.asset.Archive ? undefined : code.version,
+    }, opts)).func;
+}
+
+// edgeServices are the services that run Lambda@Edge functions, and so must be able to assume their roles.
+const edgeServices = ["lambda.amazonaws.com", "edgelambda.amazonaws.com"];
+
+// createEdgeFunction creates a function for [handler] to run at CloudFront edge locations.  Lambda@Edge only runs
+// published versions of functions, so a version is always published, and the function's role also trusts Lambda@Edge.
+// The caller is responsible for creating it in us-east-1.
+export function createEdgeFunction<E, R>(
+    name: string, source: FunctionSource, handler: aws.lambda.Callback<E, R>, args: FunctionArgs,
+    opts?: ResourceOptions): FunctionResources {
+
+    const code = serializeHandler(source, handler, false);
+    const runtime = checkRuntime(name, withDefault(args.runtime, functionDefaults.runtime));
+    return createFunctionResources(name, args, opts, common => createCallbackFunction(name, {
+        ...common,
+        publish: true,
+    }, code, runtime, opts), edgeServices);
+}
+
+// defaultAssetHandler returns the handler of a function created from an asset on [runtime] that doesn't set one,
+// throwing immediately if the runtime is a known string and otherwise once its value is.  Custom runtimes start the
+// "bootstrap" executable, and every other runtime needs the entry point to be named.
+function defaultAssetHandler(name: string, runtime: pulumi.Input<string>): pulumi.Output<string> {
+    const check = (r: string) => {
+        if (!r.startsWith("provided")) {
+            throw new Error(`Function '${name}' runs on ${r}, so must set the handler within its code to invoke.`);
+        }
+        return "bootstrap";
+    };
+    if (typeof runtime === "string") {
+        check(runtime);
+    }
+    return pulumi.output(runtime).apply(check);
+}
+
+// CommonFunctionArgs are the settings, derived from a FunctionArgs, shared by functions created from callbacks and
+// from assets.
+interface CommonFunctionArgs {
+    name?: pulumi.Input<string>;
+    role: aws.iam.Role | pulumi.Input<string>;
+    environment?: pulumi.Input<{ variables: Record<string, pulumi.Input<string>> }>;
+    memorySize?: pulumi.Input<number>;
+    timeout?: pulumi.Input<number>;
+    vpcConfig?: FunctionArgs["vpcConfig"];
+    deadLetterConfig?: FunctionArgs["deadLetterConfig"];
+    tracingConfig?: FunctionArgs["tracingConfig"];
+    tags: pulumi.Output<Record<string, string>>;
+    reservedConcurrentExecutions?: pulumi.Input<number>;
+    ephemeralStorage?: { size: pulumi.Input<number> };
+    layers?: pulumi.Input<pulumi.Input<string>[]>;
+    architectures?: string[];
+    publish: boolean;
+}
+
+// createFunctionResources creates the function returned by [construct], along with its role (unless [args.role] was
+// given) and the other resources configuring it.  The role trusts [trustedServices], or just Lambda by default.
+function createFunctionResources(
+    name: string, args: FunctionArgs, opts: ResourceOptions | undefined,
+    construct: (common: CommonFunctionArgs) => aws.lambda.Function, trustedServices?: string[]): FunctionResources {
+
+    const tags = mergeTags(args.tags);
+    const ephemeralStorageSize = checkEphemeralStorageSize(name, args.ephemeralStorageSize);
+    const layers = checkLayers(name, args.layers);
+
+    // The targets events are delivered to are checked whether or not a role is created to deliver them, as the
+    // function must be able to deliver to them either way.
+    const deadLetterArn = args.deadLetterConfig === undefined ? undefined : checkDeliveryTarget(
+        name, "deadLetterConfig", pulumi.output(args.deadLetterConfig).apply(config => config.targetArn),
+        deadLetterServices);
+    const onSuccess = args.onSuccess === undefined
+        ? undefined : checkDeliveryTarget(name, "onSuccess", args.onSuccess, destinationServices);
+    const onFailure = args.onFailure === undefined
+        ? undefined : checkDeliveryTarget(name, "onFailure", args.onFailure, destinationServices);
+
+    let role = args.role;
+    let createdRole: aws.iam.Role | undefined;
+    if (!role) {
+        const policies = args.leastPrivilegeLogging ? [] : defaultComputePolicies.slice();
+        if (args.vpcConfig) {
+            // Functions in a VPC must be able to manage the network interfaces they are attached through.
+            policies.push(aws.iam.AWSLambdaVPCAccessExecutionRole);
+        }
+        if (args.tracingConfig && args.tracingConfig.mode === "Active") {
+            // Actively traced functions send trace segments to X-Ray themselves.
+            policies.push(aws.iam.AWSXRayDaemonWriteAccess);
+        }
+
+        // Policies whose ARNs are already known are attached alongside the defaults.  The rest can't be named after
+        // their ARN, so are named after their position instead.
+        const extraPolicies = args.policies || [];
+        for (const policy of extraPolicies) {
+            if (typeof policy === "string" && policies.indexOf(policy) === -1) {
+                policies.push(policy);
+            }
+        }
+
+        const roleName = claimName("role", name, args.roleName);
+        const newRole = createRole(name, policies, tags, opts, trustedServices, roleName);
+        extraPolicies.forEach((policy, i) => {
+            if (typeof policy !== "string") {
+                const attachment = new aws.iam.RolePolicyAttachment(`${name}-policy-${i}`, {
+                    role: newRole,
+                    policyArn: policy,
+                }, opts);
+            }
+        });
+        if (args.inlinePolicy !== undefined) {
+            const inlinePolicy = new aws.iam.RolePolicy(name + "-inline", {
+                role: newRole,
+                policy: pulumi.output(args.inlinePolicy).apply(document => JSON.stringify(document)),
+            }, opts);
+        }
+        if (deadLetterArn !== undefined) {
+            grantDelivery(name + "-dead-letter", newRole, deadLetterArn, deadLetterServices, opts);
+        }
+        if (onSuccess !== undefined) {
+            grantDelivery(name + "-on-success", newRole, onSuccess, destinationServices, opts);
+        }
+        if (onFailure !== undefined) {
+            grantDelivery(name + "-on-failure", newRole, onFailure, destinationServices, opts);
+        }
+
+        role = createdRole = newRole;
+    }
+
+    const func = construct({
+        name: claimName("function", name, args.functionName),
+        role: role,
+        environment: args.environment,
+        memorySize: withDefault(args.memorySize, functionDefaults.memorySize),
+        timeout: withDefault(args.timeout, functionDefaults.timeout),
+        vpcConfig: args.vpcConfig,
+        deadLetterConfig: deadLetterArn === undefined ? undefined : { targetArn: deadLetterArn },
+        tracingConfig: args.tracingConfig,
+        tags: tags,
+        reservedConcurrentExecutions: args.reservedConcurrentExecutions,
+        ephemeralStorage: ephemeralStorageSize === undefined ? undefined : { size: ephemeralStorageSize },
+        layers: layers,
+        architectures: args.architecture !== undefined ? [args.architecture] : undefined,
+        // Provisioned concurrency can only be configured for a published version of the function.
+        publish: args.provisionedConcurrentExecutions !== undefined,
+    });
+
+    // Lambda creates the function's log group on first invocation if it doesn't already exist, with logs retained
+    // forever.  When a retention is given, create it explicitly, under the name Lambda will write to, so that it can be
+    // controlled.  It isn't created otherwise, as the functions of existing stacks already have one.
+    const logRetentionInDays = withDefault(args.logRetentionInDays, functionDefaults.logRetentionInDays);
+    let logGroup: aws.cloudwatch.LogGroup | undefined;
+    if (logRetentionInDays !== undefined) {
+        logGroup = new aws.cloudwatch.LogGroup(name, {
+            name: func.name.apply(n => "/aws/lambda/" + n),
+            retentionInDays: logRetentionInDays,
+            tags: tags,
+        }, opts);
+    }
+
+    let loggingPolicy: aws.iam.RolePolicy | undefined;
+    if (createdRole && args.leastPrivilegeLogging) {
+        const loggingActions = ["logs:CreateLogStream", "logs:PutLogEvents"];
+        if (!logGroup) {
+            loggingActions.unshift("logs:CreateLogGroup");
+        }
+        loggingPolicy = new aws.iam.RolePolicy(name + "-logging", {
+            role: createdRole,
+            policy: func.name.apply(functionName => JSON.stringify({
+                Version: "2012-10-17",
+                Statement: [{
+                    Effect: "Allow",
+                    Action: loggingActions,
+                    Resource: `arn:aws:logs:*:*:log-group:/aws/lambda/${functionName}:*`,
+                }],
+            })),
+        }, opts);
+    }
+
+    let alias: aws.lambda.Alias | undefined;
+    if (args.provisionedConcurrentExecutions !== undefined) {
+        alias = new aws.lambda.Alias(name, {
+            name: "live",
+            functionName: func.name,
+            functionVersion: func.version,
+        }, opts);
+
+        const provisionedConcurrency = new aws.lambda.ProvisionedConcurrencyConfig(name, {
+            functionName: func.name,
+            qualifier: alias.name,
+            provisionedConcurrentExecutions: args.provisionedConcurrentExecutions,
+        }, opts);
+    }
+
+    if (onSuccess !== undefined || onFailure !== undefined) {
+        const invokeConfig = new aws.lambda.FunctionEventInvokeConfig(name, {
+            functionName: func.name,
+            qualifier: alias ? alias.name : undefined,
+            destinationConfig: {
+                onSuccess: onSuccess !== undefined ? { destination: onSuccess } : undefined,
+                onFailure: onFailure !== undefined ? { destination: onFailure } : undefined,
+            },
+        }, opts);
+    }
+
+    let functionUrl: aws.lambda.FunctionUrl | undefined;
+    if (args.functionUrl) {
+        functionUrl = new aws.lambda.FunctionUrl(name, {
+            functionName: func.name,
+            qualifier: alias ? alias.name : undefined,
+            authorizationType: args.functionUrl.authType,
+            cors: args.functionUrl.cors,
+        }, opts);
+
+        if (args.functionUrl.authType === "NONE") {
+            // Public URLs still require a resource policy allowing unauthenticated callers to invoke them.
+            const urlPermission = new aws.lambda.Permission(name + "-url", {
+                action: "lambda:InvokeFunctionUrl",
+                function: func.name,
+                qualifier: alias ? alias.name : undefined,
+                principal: "*",
+                functionUrlAuthType: "NONE",
+            }, opts);
+        }
+    }
+
+    // Events delivered before the function's log group exists, or before it may write to the group when it is only
+    // allowed to by a policy of its own, would go unlogged (or be logged with the wrong retention).  So the ARN that
+    // event sources invoke is only handed out once both are in place.
+    const loggingReady: pulumi.Output<string>[] = [];
+    if (logGroup) {
+        loggingReady.push(logGroup.id);
+    }
+    if (loggingPolicy) {
+        loggingReady.push(loggingPolicy.id);
+    }
+    return {
+        func: func,
+        role: createdRole,
+        alias: alias,
+        functionUrl: functionUrl,
+        logGroup: logGroup,
+        loggingPolicy: loggingPolicy,
+        targetArn: pulumi.all([alias ? alias.arn : func.arn, ...loggingReady]).apply(([arn]) => arn),
+    };
+}
+
+// checkEphemeralStorageSize validates a function's [ephemeralStorageSize], throwing immediately if it is a known number
+// and otherwise once its value is.  AWS's own error for an invalid size doesn't say what the valid range is.
+function checkEphemeralStorageSize(
+    name: string, size: pulumi.Input<number> | undefined): pulumi.Output<number> | undefined {
+
+    if (size === undefined) {
+        return undefined;
+    }
+
+    const check = (value: number) => {
+        if (value < 512 || value > 10240) {
+            throw new Error(
+                `Function '${name}' has an ephemeralStorageSize of ${value} MB, ` +
+                `but Lambda only supports sizes between 512 and 10240 MB.`);
+        }
+        return value;
+    };
+    if (typeof size === "number") {
+        check(size);
+    }
+    return pulumi.output(size).apply(check);
+}
+
+// The Node.js runtimes Lambda currently supports creating functions with.
+const supportedRuntimes = ["nodejs18.x", "nodejs20.x", "nodejs22.x"];
+
+// checkRuntime validates a function's [runtime], throwing immediately if it is a known string and otherwise once its
+// value is.
+function checkRuntime(name: string, runtime: pulumi.Input<string> | undefined): pulumi.Output<string> | undefined {
+    if (runtime === undefined) {
+        return undefined;
+    }
+
+    const check = (value: string) => {
+        if (!value.startsWith("nodejs")) {
+            throw new Error(
+                `Function '${name}' has a runtime of '${value}', but handlers are serialized as JavaScript and ` +
+                `can only run on a Node.js runtime.`);
+        }
+        if (supportedRuntimes.indexOf(value) === -1) {
+            throw new Error(
+                `Function '${name}' has a runtime of '${value}', which is not one of the supported runtimes: ` +
+                `${supportedRuntimes.join(", ")}.`);
+        }
+        return value;
+    };
+    if (typeof runtime === "string") {
+        check(runtime);
+    }
+    return pulumi.output(runtime).apply(check);
+}
+
+// Lambda rejects functions with more layers than this.
+const maxLayers = 5;
+
+// checkLayers validates the number of a function's [layers], throwing immediately if the list is known and otherwise
+// once it is.
+function checkLayers(
+    name: string, layers: pulumi.Input<pulumi.Input<string>[]> | undefined): pulumi.Output<string[]> | undefined {
+
+    if (layers === undefined) {
+        return undefined;
+    }
+
+    const check = (count: number) => {
+        if (count > maxLayers) {
+            throw new Error(
+                `Function '${name}' has ${count} layers, but Lambda only supports up to ${maxLayers}.`);
+        }
+    };
+    if (Array.isArray(layers)) {
+        check(layers.length);
+    }
+    return pulumi.output(layers).apply(arns => {
+        check(arns.length);
+        return arns;
+    });
+}
+
+// claimedNames maps the explicit function and role names given so far to the functions they were given for.
+const claimedNames: Record<"function" | "role", Map<string, string>> = {
+    function: new Map(),
+    role: new Map(),
+};
+
+// claimName records that function [name] asks for its [kind] to be named [explicitName], throwing if another function
+// in the program already has.  The check is immediate if the name is a known string, and otherwise once its value is.
+function claimName(
+    kind: "function" | "role", name: string,
+    explicitName: pulumi.Input<string> | undefined): pulumi.Input<string> | undefined {
+
+    if (explicitName === undefined) {
+        return undefined;
+    }
+
+    const claim = (n: string) => {
+        const claimant = claimedNames[kind].get(n);
+        if (claimant !== undefined && claimant !== name) {
+            throw new Error(
+                `Function '${name}' sets its ${kind} name to '${n}', which function '${claimant}' already uses.  ` +
+                `Explicit names must be unique within an account${kind === "function" ? " and region" : ""}, ` +
+                `including across stacks, so they also collide when this program is deployed to more than one ` +
+                `stack there.  Leave the name unset to have a unique one generated.`);
+        }
+        claimedNames[kind].set(n, name);
+        return n;
+    };
+    if (typeof explicitName === "string") {
+        return claim(explicitName);
+    }
+    return pulumi.output(explicitName).apply(claim);
+}
+
+// withDefault returns [value] if it was supplied, and [defaultValue] otherwise.
+function withDefault<T>(value: T | undefined, defaultValue: T | undefined): T | undefined {
+    return value !== undefined ? value : defaultValue;
+}
+
+// The actions a function's role needs in order to deliver events to a target, keyed by the target's service.
+const deliveryActions: Record<string, string> = {
+    "sqs": "sqs:SendMessage",
+    "sns": "sns:Publish",
+    "events": "events:PutEvents",
+    "lambda": "lambda:InvokeFunction",
+};
+
+// The services that can be the destination of an asynchronous invocation.
+const destinationServices = ["sqs", "sns", "events", "lambda"];
+
+// The services a function's dead-letter target can be in.
+const deadLetterServices = ["sqs", "sns"];
+
+// checkDeliveryTarget validates that the [setting] of function [name], [targetArn], refers to a resource in one of
+// [services], throwing immediately if it is a known string and otherwise once its value is.
+function checkDeliveryTarget(
+    name: string, setting: string, targetArn: pulumi.Input<string>, services: string[]): pulumi.Output<string> {
+
+    const check = (arn: string) => {
+        if (services.indexOf(arn.split(":")[2]) === -1) {
+            throw new Error(
+                `Function '${name}' has a ${setting} of '${arn}', but it must be the ARN of one of: ` +
+                `${services.join(", ")}.`);
+        }
+        return arn;
+    };
+    if (typeof targetArn === "string") {
+        check(targetArn);
+    }
+    return pulumi.output(targetArn).apply(check);
+}
+
+// grantDelivery allows [role] to deliver events to [targetArn], which must refer to a resource in one of [services].
+export function grantDelivery(
+    name: string, role: aws.iam.Role, targetArn: pulumi.Output<string>, services: string[],
+    opts?: ResourceOptions): aws.iam.RolePolicy {
+
+    return new aws.iam.RolePolicy(name, {
+        role: role,
+        policy: targetArn.apply(arn => {
+            const service = arn.split(":")[2];
+            if (services.indexOf(service) === -1) {
+                throw new Error(`'${arn}' must be the ARN of one of: ${services.join(", ")}.`);
+            }
+
+            return JSON.stringify({
+                Version: "2012-10-17",
+                Statement: [{
+                    Effect: "Allow",
+                    Action: deliveryActions[service],
+                    Resource: arn,
+                }],
+            });
+        }),
+    }, opts);
+}
+
+// grantSourceRead allows [role] to perform [actions] on [sourceArn], so that an event source mapping invoking the
+// role's function can read from its source when the role hasn't been granted broader access.
+export function grantSourceRead(
+    name: string, role: aws.iam.Role, sourceArn: pulumi.Input<string>, actions: string[],
+    opts?: ResourceOptions): aws.iam.RolePolicy {
+
+    return new aws.iam.RolePolicy(name, {
+        role: role,
+        policy: pulumi.output(sourceArn).apply(arn => JSON.stringify({
+            Version: "2012-10-17",
+            Statement: [{
+                Effect: "Allow",
+                Action: actions,
+                Resource: arn,
+            }],
+        })),
+    }, opts);
+}
+
+function createRole(
+    name: string, policies: string[], tags: pulumi.Input<Record<string, string>>,
+    opts?: ResourceOptions, trustedServices?: string[], roleName?: pulumi.Input<string>): aws.iam.Role {
+
+    const assumeRolePolicy = trustedServices === undefined ? lambdaRolePolicy : {
+        ...lambdaRolePolicy,
+        "Statement": [{ ...lambdaRolePolicy.Statement[0], "Principal": { "Service": trustedServices } }],
+    };
+    const role = new aws.iam.Role(name, {
+        name: roleName,
+        assumeRolePolicy: JSON.stringify(assumeRolePolicy),
+        tags: tags,
+    }, opts);
+
+    for (const policy of policies) {
+        const attachment = new aws.iam.RolePolicyAttachment(name + "-" + sha1hash(policy), {
+            role: role,
+            policyArn: policy,
+        }, opts);
+    }
+
+    return role;
+}
+
 /** @deprecated Use [lambda.createCallbackFunction] instead. */
 export function createLambdaFunction<E, R>(
-    name: string, handler: Handler<E, R>, opts?: ResourceOptions,
+    name: string, handler: aws.lambda.EventHandler<E, R>, opts?: ResourceOptions,
     functionOptions?: aws.serverless.FunctionOptions): aws.lambda.Function {
 
     if (typeof handler === "function") {
@@ -14,8 +14,28 @@
 
 import * as apigateway from "./api";
 import * as bucket from "./bucket";
+import * as cloudfront from "./cloudfront";
 import * as cloudwatch from "./cloudwatch";
+import * as cognito from "./cognito";
+import * as dynamodb from "./dynamodb";
+import * as kinesis from "./kinesis";
 import * as queue from "./queue";
+import * as ses from "./ses";
+import * as subscription from "./sources";
+import * as stepfunctions from "./stepfunctions";
+import * as timer from "./timer";
 import * as topic from "./topic";
 
-export { apigateway, bucket, cloudwatch, queue, topic };
+export {
+    createAlarms, DurationAlarmArgs, FunctionAlarms, FunctionAlarmsArgs, MetricAlarmArgs,
+} from "./alarms";
+export {
+    AssetFunctionArgs, fromAsset, FunctionArgs, FunctionCode, FunctionDefaults, handlerFactory, HandlerFactory,
+    setDefaultFunctionOptions,
+} from "./function";
+export { setDefaultTags } from "./utils";
+
+export {
+    apigateway, bucket, cloudfront, cloudwatch, cognito, dynamodb, kinesis, queue, ses, stepfunctions, subscription,
+    timer, topic,
+};
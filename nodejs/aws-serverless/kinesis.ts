@@ -0,0 +1,236 @@
+// Copyright 2016-2018, Pulumi Corporation.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+import * as aws from "@pulumi/aws";
+import * as pulumi from "@pulumi/pulumi";
+
+import { createFunction, FunctionArgs, grantDelivery, grantSourceRead, Handler } from "./function";
+import {
+    BatchItemFailuresResponse, checkBatchingWindow, checkBatchSize, checkMaximumRecordAge, checkMaximumRetryAttempts,
+    checkTumblingWindow, EventSubscription, FilterCriteria, functionResponseTypes, maxStreamBatchSize,
+    serializeFilterCriteria, StreamRetryArgs, TumblingWindowEventFields, TumblingWindowResponse,
+} from "./subscription";
+import { childOptions, mergeTags } from "./utils";
+
+export interface StreamEvent {
+    Records: StreamEventRecord[];
+}
+
+/** An alias for [StreamEvent], matching the name AWS uses for this event. */
+export type KinesisStreamEvent = StreamEvent;
+
+export interface StreamEventRecord {
+    kinesis: {
+        partitionKey: string;
+        kinesisSchemaVersion: string;
+        // Base64 encoded record payload.
+        data: string;
+        sequenceNumber: string;
+        approximateArrivalTimestamp: number;
+    };
+    eventSource: string;
+    eventID: string;
+    invokeIdentityArn: string;
+    eventVersion: string;
+    eventName: string;
+    eventSourceARN: string;
+    awsRegion: string;
+}
+
+export type StreamEventHandler = Handler<StreamEvent, void | BatchItemFailuresResponse>;
+
+/**
+ * The event passed to the handler of a subscription with [tumblingWindowInSeconds] set.
+ */
+export interface StreamWindowEvent extends StreamEvent, TumblingWindowEventFields {
+}
+
+export type StreamWindowEventHandler = Handler<StreamWindowEvent, TumblingWindowResponse>;
+
+// AnyStreamEventHandler covers handlers both with and without a tumbling window, so that either can be passed to
+// createFunction.
+type AnyStreamEventHandler = Handler<StreamEvent, void | BatchItemFailuresResponse | TumblingWindowResponse>;
+
+export interface StreamSubscriptionArgs extends FunctionArgs, StreamRetryArgs {
+    /**
+     * The largest number of records that Lambda will retrieve from your event source at the time of invocation.
+     * Defaults to 100, and may be up to 10000.
+     */
+    batchSize?: pulumi.Input<number>;
+
+    /**
+     * The maximum amount of time, in seconds, Lambda spends gathering records before invoking the function.
+     */
+    maximumBatchingWindowInSeconds?: pulumi.Input<number>;
+
+    /**
+     * Only invoke the function for records matching one of the given filters.
+     */
+    filterCriteria?: pulumi.Input<FilterCriteria>;
+
+    /**
+     * Whether the handler reports which records in a batch failed by returning a [BatchItemFailuresResponse], rather
+     * than the whole batch being retried whenever it throws.
+     */
+    reportBatchItemFailures?: pulumi.Input<boolean>;
+
+    /**
+     * Groups records into consecutive windows of the given number of seconds, between 0 and 900, passing state from
+     * one invocation to the next within each window.  The handler should then be a [StreamWindowEventHandler].
+     */
+    tumblingWindowInSeconds?: pulumi.Input<number>;
+
+    /**
+     * Where in the stream the subscription starts reading when it is first created: from the oldest record still
+     * retained ("TRIM_HORIZON"), from new records only ("LATEST"), or from [startingPositionTimestamp]
+     * ("AT_TIMESTAMP").  Defaults to "LATEST".
+     */
+    startingPosition?: "TRIM_HORIZON" | "LATEST" | "AT_TIMESTAMP";
+
+    /**
+     * The time, in RFC3339 format (i.e. "2018-09-01T00:00:00Z"), to start reading from.  Required when, and only
+     * allowed when, [startingPosition] is "AT_TIMESTAMP".
+     */
+    startingPositionTimestamp?: pulumi.Input<string>;
+
+    /**
+     * Whether to read the stream through a dedicated enhanced fan-out consumer, giving the subscription its own
+     * read throughput and lower latency rather than sharing the stream's with every other reader.  This is not an
+     * Input as it determines which resources are created.
+     */
+    enhancedFanOut?: boolean;
+}
+
+// The actions a mapping needs its function's role to be allowed to read a stream with.
+const streamReadActions = [
+    "kinesis:DescribeStream", "kinesis:DescribeStreamSummary", "kinesis:GetRecords", "kinesis:GetShardIterator",
+    "kinesis:ListShards",
+];
+
+/**
+ * Creates a new subscription to the given Kinesis stream using the handler provided, along with optional options to
+ * control the behavior of the subscription.
+ */
+export function subscribe(
+    name: string, stream: aws.kinesis.Stream, handler: StreamEventHandler | StreamWindowEventHandler,
+    args?: StreamSubscriptionArgs, opts?: pulumi.ComponentResourceOptions): StreamEventSubscription {
+
+    return new StreamEventSubscription(name, stream, handler, args, opts);
+}
+
+export class StreamEventSubscription extends EventSubscription {
+    public readonly stream: aws.kinesis.Stream;
+    public readonly eventSourceMapping: aws.lambda.EventSourceMapping;
+    /**
+     * The stream consumer records are read through, created when [StreamSubscriptionArgs.enhancedFanOut] is set.
+     */
+    public readonly consumer?: aws.kinesis.StreamConsumer;
+
+    public constructor(
+        name: string, stream: aws.kinesis.Stream, handler: StreamEventHandler | StreamWindowEventHandler,
+        args?: StreamSubscriptionArgs, opts?: pulumi.ComponentResourceOptions) {
+
+        super("aws-serverless:kinesis:StreamEventSubscription", name, { stream: stream }, opts);
+
+        args = args || {};
+        const tumblingWindow = checkTumblingWindow(name, args.tumblingWindowInSeconds);
+        const batchSize = checkBatchSize(name, "Kinesis", args.batchSize, maxStreamBatchSize);
+        const batchingWindow = checkBatchingWindow(name, args.maximumBatchingWindowInSeconds);
+        const retryAttempts = checkMaximumRetryAttempts(name, args.maximumRetryAttempts);
+        const recordAge = checkMaximumRecordAge(name, args.maximumRecordAgeInSeconds);
+
+        const startingPosition = args.startingPosition || "LATEST";
+        if (startingPosition === "AT_TIMESTAMP" && args.startingPositionTimestamp === undefined) {
+            throw new Error(
+                `Subscription '${name}' has a startingPosition of AT_TIMESTAMP, but no startingPositionTimestamp.`);
+        }
+        if (startingPosition !== "AT_TIMESTAMP" && args.startingPositionTimestamp !== undefined) {
+            throw new Error(
+                `Subscription '${name}' sets startingPositionTimestamp, ` +
+                `which requires a startingPosition of AT_TIMESTAMP.`);
+        }
+
+        this.stream = stream;
+        const { func, role, functionUrl, targetArn } = createFunction(
+            name + "-stream-subscription", { subscription: name, source: "Kinesis stream" },
+            <AnyStreamEventHandler>handler, args, childOptions(this, opts));
+        this.func = func;
+        this.role = role;
+        this.functionUrl = functionUrl && functionUrl.functionUrl;
+
+        if (role && args.discardedBatchDestination !== undefined) {
+            grantDelivery(name + "-discarded-batch", role, pulumi.output(args.discardedBatchDestination),
+                ["sqs", "sns"], childOptions(this, opts));
+        }
+
+        let eventSourceArn = stream.arn;
+        const mappingDependencies: pulumi.Resource[] = [];
+        if (args.enhancedFanOut) {
+            this.consumer = new aws.kinesis.StreamConsumer(name, {
+                streamArn: stream.arn,
+            }, childOptions(this, opts));
+            eventSourceArn = this.consumer.arn;
+
+            if (role) {
+                // Reading through a consumer subscribes to each shard of the stream, rather than polling them.
+                const fanOutPolicy = new aws.iam.RolePolicy(name + "-fan-out", {
+                    role: role,
+                    policy: pulumi.all([stream.arn, this.consumer.arn]).apply(([streamArn, consumerArn]) =>
+                        JSON.stringify({
+                            Version: "2012-10-17",
+                            Statement: [
+                                {
+                                    Effect: "Allow",
+                                    Action: ["kinesis:SubscribeToShard", "kinesis:DescribeStreamConsumer"],
+                                    Resource: consumerArn,
+                                },
+                                {
+                                    Effect: "Allow",
+                                    Action: streamReadActions,
+                                    Resource: streamArn,
+                                },
+                            ],
+                        })),
+                }, childOptions(this, opts));
+                mappingDependencies.push(fanOutPolicy);
+            }
+        } else if (role && args.leastPrivilegeLogging) {
+            // A role only allowed to write its function's logs must also be allowed to read the stream for the
+            // mapping to poll it.
+            mappingDependencies.push(grantSourceRead(
+                name + "-read", role, stream.arn, streamReadActions, childOptions(this, opts)));
+        }
+
+        this.eventSourceMapping = new aws.lambda.EventSourceMapping(name, {
+            eventSourceArn: eventSourceArn,
+            functionName: targetArn,
+            startingPosition: startingPosition,
+            startingPositionTimestamp: args.startingPositionTimestamp,
+            batchSize: batchSize,
+            maximumBatchingWindowInSeconds: batchingWindow,
+            filterCriteria: args.filterCriteria === undefined
+                ? undefined : serializeFilterCriteria(args.filterCriteria),
+            maximumRetryAttempts: retryAttempts,
+            maximumRecordAgeInSeconds: recordAge,
+            bisectBatchOnFunctionError: args.bisectBatchOnFunctionError,
+            destinationConfig: args.discardedBatchDestination === undefined
+                ? undefined : { onFailure: { destinationArn: args.discardedBatchDestination } },
+            functionResponseTypes: functionResponseTypes(args.reportBatchItemFailures),
+            tumblingWindowInSeconds: tumblingWindow,
+            tags: mergeTags(args.tags),
+        }, childOptions(this, opts, mappingDependencies));
+
+        this.registerOutputs();
+    }
+}
@@ -12,28 +12,316 @@
 // See the License for the specific language governing permissions and
 // limitations under the License.
 
+import * as aws from "@pulumi/aws";
 import * as pulumi from "@pulumi/pulumi";
 
-import { sqs } from "@pulumi/aws";
+import { createFunction, FunctionArgs, grantSourceRead, Handler } from "./function";
+import {
+    BatchItemFailuresResponse, checkBatchingWindow, checkBatchSize, EventSubscription, FilterCriteria,
+    functionResponseTypes, serializeFilterCriteria,
+} from "./subscription";
+import { childOptions, mergeTags, sha1hash } from "./utils";
 
-/** @deprecated use [sqs.QueueEvent] instead */
-export type QueueEvent = sqs.QueueEvent;
-/** @deprecated use [sqs.QueueRecord] instead */
-export type QueueRecord = sqs.QueueRecord;
-/** @deprecated use [sqs.QueueEventHandler] instead */
-export type QueueEventHandler = sqs.QueueEventHandler;
-/** @deprecated use [sqs.QueueSubscriptionArgs] instead */
-export type QueueSubscriptionArgs = sqs.QueueEventSubscriptionArgs;
+export interface QueueEvent {
+    Records: QueueRecord[];
+}
+
+/** An alias for [QueueEvent], matching the name AWS uses for this event. */
+export type SQSEvent = QueueEvent;
+
+export interface QueueRecord {
+    messageId: string;
+    receiptHandle: string;
+    body: string;
+    attributes: {
+        ApproximateReceiveCount: string;
+        SentTimestamp: string;
+        SenderId: string;
+        ApproximateFirstReceiveTimestamp: string;
+        // Only present for messages received from FIFO queues.
+        MessageGroupId?: string;
+        MessageDeduplicationId?: string;
+        SequenceNumber?: string;
+    };
+    messageAttributes: Record<string, {
+        stringValue?: string;
+        binaryValue?: string;
+        dataType: string;
+    }>;
+    md5OfBody: string;
+    eventSource: string;
+    eventSourceARN: string;
+    awsRegion: string;
+}
+
+export type QueueEventHandler = Handler<QueueEvent, void | BatchItemFailuresResponse>;
+
+export interface QueueSubscriptionArgs extends FunctionArgs {
+    /**
+     * The largest number of records that Lambda will retrieve from your event source at the time of invocation.
+     * Defaults to 10, which is also the maximum unless [maximumBatchingWindowInSeconds] is at least 1, in which case
+     * batches of up to 10000 are supported.
+     */
+    batchSize?: pulumi.Input<number>;
+
+    /**
+     * The maximum amount of time, in seconds, Lambda spends gathering records before invoking the function.  Must be
+     * between 0 and 300, and cannot be set for FIFO queues.
+     */
+    maximumBatchingWindowInSeconds?: pulumi.Input<number>;
+
+    /**
+     * Only invoke the function for records matching one of the given filters.
+     */
+    filterCriteria?: pulumi.Input<FilterCriteria>;
+
+    /**
+     * Whether the handler reports which records in a batch failed by returning a [BatchItemFailuresResponse], rather
+     * than the whole batch being retried whenever it throws.
+     */
+    reportBatchItemFailures?: pulumi.Input<boolean>;
+
+    /**
+     * The largest number of concurrent invocations of the function the queue drives, protecting the resources it
+     * shares with other consumers.  Must be between 2 and 1000.  Unlike [reservedConcurrentExecutions], messages over
+     * the limit remain in the queue rather than being throttled.
+     */
+    maximumConcurrency?: pulumi.Input<number>;
+
+    /**
+     * Whether to fail the deployment if the queue's visibility timeout is shorter than the function's timeout, in
+     * which case messages would be redelivered while still being processed.  AWS recommends a visibility timeout of
+     * six times the function's timeout, which [createQueue] sets given [QueueArgs.handlerTimeout].
+     */
+    enforceVisibilityTimeout?: boolean;
+}
+
+export interface QueueArgs extends aws.sqs.QueueArgs {
+    /**
+     * Whether to create a FIFO queue.  FIFO queues are named with the ".fifo" suffix AWS requires, and use
+     * content-based deduplication unless [contentBasedDeduplication] is set to false.
+     */
+    fifo?: boolean;
+
+    /**
+     * The timeout, in seconds, of the function that will process the queue's messages.  When given, and
+     * [visibilityTimeoutSeconds] isn't, the visibility timeout is set to six times it, as AWS recommends.
+     */
+    handlerTimeout?: pulumi.Input<number>;
+
+    /**
+     * Moves messages that have been received [maxReceiveCount] times without being deleted to a dead-letter queue,
+     * rather than retrying them until they expire.  Unless an existing [queue] is given, a dead-letter queue is
+     * created alongside this one, keeping messages for the maximum of 14 days.  Can't be combined with
+     * [redrivePolicy].
+     */
+    deadLetterQueue?: DeadLetterQueueArgs;
+}
+
+export interface DeadLetterQueueArgs {
+    /**
+     * An existing queue to move failed messages to.  It must be a FIFO queue if this one is.
+     */
+    queue?: aws.sqs.Queue;
+
+    /**
+     * The number of times a message is received before it is moved to the dead-letter queue.  Must be between 1 and
+     * 1000.
+     */
+    maxReceiveCount: pulumi.Input<number>;
+}
+
+// The visibility timeout SQS gives queues that don't set one.
+const defaultVisibilityTimeout = 30;
+
+// The longest SQS keeps messages, used for the dead-letter queues created so failures can be investigated.
+const maxMessageRetentionSeconds = 14 * 24 * 60 * 60;
+
+/**
+ * Creates a new queue, handling the settings required for FIFO queues when [args.fifo] is set.
+ */
+export function createQueue(name: string, args?: QueueArgs, opts?: pulumi.ResourceOptions): aws.sqs.Queue {
+    const { fifo, handlerTimeout, deadLetterQueue, ...queueArgs } = args || <QueueArgs>{};
+    if (handlerTimeout !== undefined && queueArgs.visibilityTimeoutSeconds === undefined) {
+        queueArgs.visibilityTimeoutSeconds = pulumi.output(handlerTimeout).apply(timeout => 6 * timeout);
+    }
+    if (deadLetterQueue !== undefined) {
+        if (queueArgs.redrivePolicy !== undefined) {
+            throw new Error(`Queue '${name}' sets both deadLetterQueue and redrivePolicy.`);
+        }
+        queueArgs.redrivePolicy = redrivePolicy(name, !!fifo, deadLetterQueue, opts);
+    }
+    if (!fifo) {
+        return new aws.sqs.Queue(name, queueArgs, opts);
+    }
+
+    // FIFO queue names must end in ".fifo", which rules out auto-naming.  Without an explicit name, derive one that
+    // is unique to this stack.
+    const queueName = queueArgs.name !== undefined
+        ? pulumi.output(queueArgs.name).apply(n => n.endsWith(".fifo") ? n : n + ".fifo")
+        : `${name}-${sha1hash(pulumi.getProject() + ":" + pulumi.getStack())}.fifo`;
+
+    return new aws.sqs.Queue(name, {
+        ...queueArgs,
+        name: queueName,
+        fifoQueue: true,
+        contentBasedDeduplication: queueArgs.contentBasedDeduplication !== undefined
+            ? queueArgs.contentBasedDeduplication : true,
+    }, opts);
+}
+
+// redrivePolicy returns the redrive policy moving the failed messages of queue [name] to [args.queue], or to a new
+// dead-letter queue when it isn't given.
+function redrivePolicy(
+    name: string, fifo: boolean, args: DeadLetterQueueArgs, opts?: pulumi.ResourceOptions): pulumi.Output<string> {
+
+    const check = (count: number) => {
+        if (count < 1 || count > 1000) {
+            throw new Error(
+                `Queue '${name}' has a maxReceiveCount of ${count}, but SQS only supports values between 1 and 1000.`);
+        }
+        return count;
+    };
+    if (typeof args.maxReceiveCount === "number") {
+        check(args.maxReceiveCount);
+    }
+
+    const deadLetterQueue = args.queue || createQueue(name + "-dead-letter", {
+        fifo: fifo,
+        messageRetentionSeconds: maxMessageRetentionSeconds,
+    }, opts);
+
+    return pulumi.all([deadLetterQueue.arn, deadLetterQueue.fifoQueue, args.maxReceiveCount]).apply(
+        ([arn, deadLetterFifo, maxReceiveCount]) => {
+            // SQS requires a queue's dead-letter queue to be of the same type.
+            if (!!deadLetterFifo !== fifo) {
+                throw new Error(
+                    `Queue '${name}' ${fifo ? "is" : "isn't"} a FIFO queue, ` +
+                    `so its dead-letter queue must ${fifo ? "be one too" : "not be one either"}.`);
+            }
+            return JSON.stringify({ deadLetterTargetArn: arn, maxReceiveCount: check(maxReceiveCount) });
+        });
+}
 
-/** @deprecated use [sqs.Queue.onEvent] instead */
+// The actions a function's role needs for an event source mapping to poll a queue on its behalf.
+export const queueReadActions = [
+    "sqs:ReceiveMessage", "sqs:DeleteMessage", "sqs:GetQueueAttributes", "sqs:ChangeMessageVisibility",
+];
+
+/**
+ * Creates a new subscription to the given queue using the handler provided, along with optional options to control
+ * the behavior of the subscription.
+ */
 export function subscribe(
-    name: string, queue: sqs.Queue, handler: QueueEventHandler,
-    args?: QueueSubscriptionArgs, opts?: pulumi.ResourceOptions): QueueEventSubscription {
+    name: string, queue: aws.sqs.Queue, handler: QueueEventHandler,
+    args?: QueueSubscriptionArgs, opts?: pulumi.ComponentResourceOptions): QueueEventSubscription {
+
+    return new QueueEventSubscription(name, queue, handler, args, opts);
+}
+
+export class QueueEventSubscription extends EventSubscription {
+    public readonly queue: aws.sqs.Queue;
+    public readonly eventSourceMapping: aws.lambda.EventSourceMapping;
+
+    public constructor(
+        name: string, queue: aws.sqs.Queue, handler: QueueEventHandler,
+        args?: QueueSubscriptionArgs, opts?: pulumi.ComponentResourceOptions) {
+
+        super("aws-serverless:queue:QueueEventSubscription", name, { queue: queue }, opts);
 
-    return queue.onEvent(name, handler, args, opts);
+        args = args || {};
+
+        const batchingWindow = args.maximumBatchingWindowInSeconds;
+        const validBatchingWindow = checkBatchingWindow(name, batchingWindow);
+
+        // Batches of more than 10 messages are only allowed when Lambda waits to gather them.
+        const maxBatchSize = batchingWindow === undefined || typeof batchingWindow === "number"
+            ? (batchingWindow !== undefined && batchingWindow >= 1 ? 10000 : 10)
+            : pulumi.output(batchingWindow).apply(window => window >= 1 ? 10000 : 10);
+        const batchSize = checkBatchSize(name, "SQS", args.batchSize, maxBatchSize, maxBatchSize === 10
+            ? "  Set maximumBatchingWindowInSeconds to at least 1 for batches of up to 10000 messages." : "");
+
+        const maximumConcurrency = checkMaximumConcurrency(name, args.maximumConcurrency);
+
+        // Whether the queue is FIFO may not be known until it has been created, so check it as part of computing the
+        // mapping's batching window.
+        const checkedBatchingWindow = validBatchingWindow === undefined ? undefined :
+            pulumi.all([queue.fifoQueue, validBatchingWindow]).apply(([fifoQueue, window]) => {
+                if (fifoQueue) {
+                    throw new Error(
+                        `Subscription '${name}' sets maximumBatchingWindowInSeconds, ` +
+                        `which is not supported for FIFO queues.`);
+                }
+                return window;
+            });
+
+        this.queue = queue;
+        const { func, role, functionUrl, targetArn } = createFunction(
+            name + "-queue-subscription", { subscription: name, source: "queue" },
+            handler, args, childOptions(this, opts));
+        this.func = func;
+        this.role = role;
+        this.functionUrl = functionUrl && functionUrl.functionUrl;
+
+        // Checking the timeouts as part of the mapping's source keeps the function from being subscribed to a queue
+        // that would redeliver its messages mid-processing.
+        const eventSourceArn = !args.enforceVisibilityTimeout ? queue.arn :
+            pulumi.all([queue.arn, queue.visibilityTimeoutSeconds, func.timeout]).apply(
+                ([arn, visibilityTimeout = defaultVisibilityTimeout, timeout]) => {
+                    if (timeout !== undefined && visibilityTimeout < timeout) {
+                        throw new Error(
+                            `Subscription '${name}' has a function timeout of ${timeout} seconds, but its queue's ` +
+                            `visibility timeout is ${visibilityTimeout} seconds.  Messages would be redelivered ` +
+                            `while still being processed; set the queue's visibilityTimeoutSeconds to at least ` +
+                            `${timeout} (AWS recommends ${6 * timeout}).`);
+                    }
+                    return arn;
+                });
+
+        // A role only allowed to write its function's logs must also be allowed to receive the queue's messages for
+        // the mapping to poll it.
+        const mappingDependencies: pulumi.Resource[] = [];
+        if (role && args.leastPrivilegeLogging) {
+            mappingDependencies.push(
+                grantSourceRead(name + "-read", role, queue.arn, queueReadActions, childOptions(this, opts)));
+        }
+
+        this.eventSourceMapping = new aws.lambda.EventSourceMapping(name, {
+            eventSourceArn: eventSourceArn,
+            functionName: targetArn,
+            batchSize: batchSize,
+            maximumBatchingWindowInSeconds: checkedBatchingWindow,
+            filterCriteria: args.filterCriteria === undefined
+                ? undefined : serializeFilterCriteria(args.filterCriteria),
+            functionResponseTypes: functionResponseTypes(args.reportBatchItemFailures),
+            scalingConfig: maximumConcurrency === undefined
+                ? undefined : { maximumConcurrency: maximumConcurrency },
+            tags: mergeTags(args.tags),
+        }, childOptions(this, opts, mappingDependencies));
+
+        this.registerOutputs();
+    }
 }
 
-/** @deprecated use [sqs.QueueEventSubscription] instead */
-export const QueueEventSubscription = sqs.QueueEventSubscription;
-/** @deprecated use [sqs.QueueEventSubscription] instead */
-export type QueueEventSubscription = sqs.QueueEventSubscription;
+// checkMaximumConcurrency validates a subscription's [maximumConcurrency], throwing immediately if it is a known number
+// and otherwise once its value is.
+function checkMaximumConcurrency(
+    name: string, maximumConcurrency: pulumi.Input<number> | undefined): pulumi.Output<number> | undefined {
+
+    if (maximumConcurrency === undefined) {
+        return undefined;
+    }
+
+    const check = (concurrency: number) => {
+        if (concurrency < 2 || concurrency > 1000) {
+            throw new Error(
+                `Subscription '${name}' has a maximumConcurrency of ${concurrency}, ` +
+                `but SQS only supports values between 2 and 1000.`);
+        }
+        return concurrency;
+    };
+    if (typeof maximumConcurrency === "number") {
+        check(maximumConcurrency);
+    }
+    return pulumi.output(maximumConcurrency).apply(check);
+}
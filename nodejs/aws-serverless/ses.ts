@@ -0,0 +1,161 @@
+// Copyright 2016-2018, Pulumi Corporation.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+
+import * as aws from "@pulumi/aws";
+import * as pulumi from "@pulumi/pulumi";
+
+import { createFunction, FunctionArgs, Handler } from "./function";
+import { EventSubscription } from "./subscription";
+import { childOptions } from "./utils";
+
+export interface EmailEvent {
+    Records: EmailRecord[];
+}
+
+export interface EmailRecord {
+    eventSource: string;
+    eventVersion: string;
+    ses: {
+        mail: {
+            timestamp: string;
+            source: string;
+            messageId: string;
+            destination: string[];
+            headersTruncated: boolean;
+            headers: { name: string; value: string }[];
+            commonHeaders: {
+                returnPath?: string;
+                from?: string[];
+                date?: string;
+                to?: string[];
+                messageId?: string;
+                subject?: string;
+            };
+        };
+        receipt: {
+            timestamp: string;
+            processingTimeMillis: number;
+            recipients: string[];
+            spamVerdict: { status: string };
+            virusVerdict: { status: string };
+            spfVerdict: { status: string };
+            dkimVerdict: { status: string };
+            dmarcVerdict: { status: string };
+            action: {
+                type: string;
+                functionArn: string;
+                invocationType: string;
+            };
+        };
+    };
+}
+
+export type EmailEventHandler = Handler<EmailEvent, void>;
+
+export interface ReceiptRuleArgs {
+    /**
+     * The name of the receipt rule set to add the rule to.  The rule set must be active for the rule to take effect.
+     */
+    ruleSetName: pulumi.Input<string>;
+
+    /**
+     * The addresses or domains the rule applies to.  Defaults to every recipient of the verified domains.
+     */
+    recipients?: pulumi.Input<pulumi.Input<string>[]>;
+
+    /**
+     * A bucket to store the raw message in before the handler is invoked.  The bucket's policy must allow SES to
+     * write to it.  The event passed to the handler only contains the message's headers, so this is the way to get
+     * at its body.
+     */
+    bucket?: aws.s3.Bucket;
+
+    /**
+     * The prefix of the keys raw messages are stored under in [bucket].
+     */
+    objectKeyPrefix?: pulumi.Input<string>;
+
+    /**
+     * Whether to scan messages for spam and viruses.  The verdicts are included in the event passed to the handler.
+     */
+    scanEnabled?: pulumi.Input<boolean>;
+}
+
+export interface EmailSubscriptionArgs extends FunctionArgs {
+}
+
+/**
+ * Creates a new subscription that invokes the handler provided whenever SES receives an email matching the given
+ * receipt rule.
+ */
+export function onEmailReceived(
+    name: string, rule: ReceiptRuleArgs, handler: EmailEventHandler,
+    args?: EmailSubscriptionArgs, opts?: pulumi.ComponentResourceOptions): EmailEventSubscription {
+
+    return new EmailEventSubscription(name, rule, handler, args, opts);
+}
+
+export class EmailEventSubscription extends EventSubscription {
+    public readonly receiptRule: aws.ses.ReceiptRule;
+
+    public constructor(
+        name: string, rule: ReceiptRuleArgs, handler: EmailEventHandler,
+        args?: EmailSubscriptionArgs, opts?: pulumi.ComponentResourceOptions) {
+
+        super("aws-serverless:ses:EmailEventSubscription", name, {}, opts);
+
+        args = args || {};
+
+        const { func, role, functionUrl, targetArn } = createFunction(
+            name + "-email-subscription", { subscription: name, source: "email" },
+            handler, args, childOptions(this, opts));
+        this.func = func;
+        this.role = role;
+        this.functionUrl = functionUrl && functionUrl.functionUrl;
+
+        // SES receipt rules have no ARN to restrict the permission with, so restrict it to rules in the function's
+        // account.  Taking the account from the function's ARN keeps it right whichever provider the function was
+        // created with.  ARNs have the form arn:<partition>:lambda:<region>:<account>:function:<name>.
+        const accountId = func.arn.apply(arn => arn.split(":")[4]);
+        this.permission = new aws.lambda.Permission(name, {
+            function: targetArn,
+            action: "lambda:InvokeFunction",
+            principal: "ses.amazonaws.com",
+            sourceAccount: accountId,
+        }, childOptions(this, opts));
+
+        // Actions run in order of their position, so the message is stored before the handler is invoked.
+        this.receiptRule = new aws.ses.ReceiptRule(name, {
+            ruleSetName: rule.ruleSetName,
+            recipients: rule.recipients,
+            enabled: true,
+            scanEnabled: rule.scanEnabled,
+            s3Actions: rule.bucket === undefined ? undefined : [{
+                bucketName: rule.bucket.bucket,
+                objectKeyPrefix: rule.objectKeyPrefix,
+                position: 1,
+            }],
+            lambdaActions: [{
+                functionArn: targetArn,
+                invocationType: "Event",
+                position: rule.bucket === undefined ? 1 : 2,
+            }],
+        }, childOptions(this, opts, [this.permission]));
+
+        this.subscription = this.receiptRule;
+
+        this.registerOutputs();
+    }
+}
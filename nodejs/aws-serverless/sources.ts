@@ -0,0 +1,125 @@
+// Copyright 2016-2018, Pulumi Corporation.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+import * as aws from "@pulumi/aws";
+import * as pulumi from "@pulumi/pulumi";
+
+import { createFunction, FunctionArgs, grantSourceRead, Handler } from "./function";
+import * as queue from "./queue";
+import { BatchItemFailuresResponse, EventSubscription } from "./subscription";
+import * as topic from "./topic";
+import { childOptions } from "./utils";
+
+/**
+ * The options of a queue source, i.e. its batchSize.  The function's options are given to [subscribeAll] instead.
+ */
+export type QueueSourceArgs =
+    Pick<queue.QueueSubscriptionArgs, Exclude<keyof queue.QueueSubscriptionArgs, keyof FunctionArgs>>;
+
+/**
+ * The options of a topic source, i.e. its filterPolicy.  The function's options are given to [subscribeAll] instead.
+ */
+export type TopicSourceArgs =
+    Pick<topic.TopicSubscriptionArgs, Exclude<keyof topic.TopicSubscriptionArgs, keyof FunctionArgs>>;
+
+/**
+ * A source of events for [subscribeAll]: an SQS queue, read through an event source mapping, or an SNS topic.
+ */
+export type EventSource =
+    { type: "sqs"; queue: aws.sqs.Queue; args?: QueueSourceArgs } |
+    { type: "sns"; topic: aws.sns.Topic; args?: TopicSourceArgs };
+
+/**
+ * The events passed to a handler subscribed to several sources.  Records from each source are delivered separately,
+ * and can be told apart by their eventSource (SQS) or EventSource (SNS).
+ */
+export type SourceEvent = queue.QueueEvent | topic.TopicEvent;
+
+export type SourceEventHandler = Handler<SourceEvent, void | BatchItemFailuresResponse>;
+
+/**
+ * Creates a single function for the handler provided, and subscribes it to each of the given sources.  The
+ * subscription for each source is named after its position in [sources], i.e. "<name>-sqs-0".
+ */
+export function subscribeAll(
+    name: string, sources: EventSource[], handler: SourceEventHandler,
+    args?: FunctionArgs, opts?: pulumi.ComponentResourceOptions): MultiSourceSubscription {
+
+    return new MultiSourceSubscription(name, sources, handler, args, opts);
+}
+
+export class MultiSourceSubscription extends EventSubscription {
+    /**
+     * The subscriptions delivering each source's events to [func], in the order of the sources.
+     */
+    public readonly subscriptions: (queue.QueueEventSubscription | topic.TopicEventSubscription)[];
+
+    public constructor(
+        name: string, sources: EventSource[], handler: SourceEventHandler,
+        args?: FunctionArgs, opts?: pulumi.ComponentResourceOptions) {
+
+        super("aws-serverless:subscription:MultiSourceSubscription", name, {}, opts);
+
+        args = args || {};
+        if (sources.length === 0) {
+            throw new Error(`Subscription '${name}' must specify at least one source.`);
+        }
+        // Each source is subscribed to the function itself rather than to an alias of it.
+        if (args.provisionedConcurrentExecutions !== undefined) {
+            throw new Error(
+                `Subscription '${name}' sets provisionedConcurrentExecutions, ` +
+                `which is not supported for subscriptions to several sources.`);
+        }
+
+        const { func, role, functionUrl, logGroup, loggingPolicy } = createFunction(
+            name + "-sources-subscription", { subscription: name, source: "multi-source" },
+            handler, args, childOptions(this, opts));
+        this.func = func;
+        this.role = role;
+        this.functionUrl = functionUrl && functionUrl.functionUrl;
+
+        // Each source is subscribed to the function as it already exists, so isn't handed an ARN that waits for its
+        // logging to be in place.  Have the sources wait for it themselves instead.
+        const loggingDependencies: pulumi.Resource[] = [];
+        if (logGroup) {
+            loggingDependencies.push(logGroup);
+        }
+        if (loggingPolicy) {
+            loggingDependencies.push(loggingPolicy);
+        }
+
+        // The function's role is created here rather than by each queue's subscription, so when it is only allowed
+        // to write its logs it must also be allowed to receive each queue's messages here.
+        const readRole = args.leastPrivilegeLogging ? role : undefined;
+
+        this.subscriptions = sources.map((source, i) => {
+            const sourceName = `${name}-${source.type}-${i}`;
+            switch (source.type) {
+                case "sqs":
+                    const queueDependencies = !readRole ? loggingDependencies : loggingDependencies.concat(
+                        grantSourceRead(sourceName + "-read", readRole, source.queue.arn, queue.queueReadActions,
+                            childOptions(this, opts)));
+                    return queue.subscribe(
+                        sourceName, source.queue, func, source.args, childOptions(this, opts, queueDependencies));
+                case "sns":
+                    return topic.subscribe(
+                        sourceName, source.topic, func, source.args, childOptions(this, opts, loggingDependencies));
+                default:
+                    throw new Error(`Subscription '${name}' has a source of unknown type '${(<any>source).type}'.`);
+            }
+        });
+
+        this.registerOutputs();
+    }
+}
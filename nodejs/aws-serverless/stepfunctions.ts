@@ -0,0 +1,181 @@
+// Copyright 2016-2018, Pulumi Corporation.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+
+import * as aws from "@pulumi/aws";
+import * as pulumi from "@pulumi/pulumi";
+
+import { createFunction, FunctionArgs, Handler } from "./function";
+import { childOptions, mergeTags } from "./utils";
+
+/**
+ * A state machine definition in the Amazon States Language.  See
+ * https://docs.aws.amazon.com/step-functions/latest/dg/concepts-amazon-states-language.html for the full syntax.
+ */
+export interface StateMachineDefinition {
+    StartAt: string;
+    States: Record<string, any>;
+    [key: string]: any;
+}
+
+export type TaskHandler = Handler<any, any>;
+
+export interface StateMachineArgs {
+    /**
+     * The state machine's definition.  Task states named after one of [handlers] have their Resource set to that
+     * handler's function, so should leave it unset.
+     */
+    definition: pulumi.Input<StateMachineDefinition>;
+
+    /**
+     * The handlers for the definition's task states, keyed by state name.  A function is created for each callback.
+     */
+    handlers: Record<string, TaskHandler>;
+
+    /**
+     * Options for the functions created for [handlers].
+     */
+    functionArgs?: FunctionArgs;
+
+    /**
+     * Tags to apply to the state machine and its role, merged with the package-level defaults.
+     */
+    tags?: pulumi.Input<Record<string, pulumi.Input<string>>>;
+}
+
+/**
+ * Creates a Step Functions state machine whose task states invoke the handlers provided.
+ */
+export function stateMachine(
+    name: string, args: StateMachineArgs, opts?: pulumi.ComponentResourceOptions): StateMachine {
+
+    return new StateMachine(name, args, opts);
+}
+
+const statesRolePolicy = {
+    "Version": "2012-10-17",
+    "Statement": [
+        {
+            "Action": "sts:AssumeRole",
+            "Principal": {
+                "Service": "states.amazonaws.com",
+            },
+            "Effect": "Allow",
+            "Sid": "",
+        },
+    ],
+};
+
+export class StateMachine extends pulumi.ComponentResource {
+    public readonly stateMachine: aws.sfn.StateMachine;
+    public readonly role: aws.iam.Role;
+    /**
+     * The functions created for the state machine's task states, keyed by state name.
+     */
+    public readonly functions: Record<string, aws.lambda.Function>;
+
+    public constructor(name: string, args: StateMachineArgs, opts?: pulumi.ComponentResourceOptions) {
+        super("aws-serverless:stepfunctions:StateMachine", name, {}, opts);
+
+        const taskNames = Object.keys(args.handlers);
+        if (taskNames.length === 0) {
+            throw new Error(`State machine '${name}' must have at least one handler.`);
+        }
+
+        this.functions = {};
+        const targetArns: pulumi.Output<string>[] = [];
+        for (const taskName of taskNames) {
+            // State names may contain characters function names can't, so these are replaced.
+            const { func, targetArn } = createFunction(
+                name + "-" + taskName.replace(/[^a-zA-Z0-9-_]/g, "-"),
+                { subscription: name, source: `'${taskName}' task` }, args.handlers[taskName], args.functionArgs,
+                childOptions(this, opts));
+            this.functions[taskName] = func;
+            targetArns.push(targetArn);
+        }
+
+        this.role = new aws.iam.Role(name, {
+            assumeRolePolicy: JSON.stringify(statesRolePolicy),
+            tags: mergeTags(args.tags),
+        }, childOptions(this, opts));
+
+        const invokePolicy = new aws.iam.RolePolicy(name, {
+            role: this.role,
+            policy: pulumi.all(targetArns).apply(arns => JSON.stringify({
+                Version: "2012-10-17",
+                Statement: [{
+                    Effect: "Allow",
+                    Action: "lambda:InvokeFunction",
+                    Resource: arns,
+                }],
+            })),
+        }, childOptions(this, opts));
+
+        const definition = pulumi.all([args.definition, pulumi.all(targetArns)]).apply(([def, arns]) => {
+            const resources: Record<string, string> = {};
+            taskNames.forEach((taskName, i) => resources[taskName] = arns[i]);
+            return JSON.stringify(substituteResources(name, def, resources));
+        });
+
+        this.stateMachine = new aws.sfn.StateMachine(name, {
+            definition: definition,
+            roleArn: this.role.arn,
+            tags: mergeTags(args.tags),
+        }, childOptions(this, opts, [invokePolicy]));
+
+        this.registerOutputs();
+    }
+}
+
+// substituteResources returns a copy of [definition] with the Resource of each task state named in [resources] set,
+// including the states of parallel branches and map iterators.  It throws if a handler has no task state to run in.
+function substituteResources(
+    name: string, definition: StateMachineDefinition, resources: Record<string, string>): StateMachineDefinition {
+
+    const unused = new Set(Object.keys(resources));
+    const substitute = (machine: StateMachineDefinition): StateMachineDefinition => {
+        const states: Record<string, any> = {};
+        for (const stateName of Object.keys(machine.States || {})) {
+            const state = { ...machine.States[stateName] };
+            if (state.Type === "Task" && resources[stateName] !== undefined) {
+                if (state.Resource !== undefined) {
+                    throw new Error(
+                        `State machine '${name}' has a handler for task state '${stateName}', ` +
+                        `which already sets its Resource.`);
+                }
+                state.Resource = resources[stateName];
+                unused.delete(stateName);
+            }
+            if (state.Branches) {
+                state.Branches = state.Branches.map(substitute);
+            }
+            if (state.Iterator) {
+                state.Iterator = substitute(state.Iterator);
+            }
+            if (state.ItemProcessor) {
+                state.ItemProcessor = substitute(state.ItemProcessor);
+            }
+            states[stateName] = state;
+        }
+        return { ...machine, States: states };
+    };
+
+    const result = substitute(definition);
+    if (unused.size > 0) {
+        throw new Error(
+            `State machine '${name}' has handlers for ${Array.from(unused).map(n => `'${n}'`).join(", ")}, ` +
+            `but no task states of the same name.`);
+    }
+    return result;
+}
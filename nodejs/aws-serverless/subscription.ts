@@ -12,19 +12,265 @@
 // See the License for the specific language governing permissions and
 // limitations under the License.
 
-import { lambda } from "@pulumi/aws";
+import { iam, lambda } from "@pulumi/aws";
 import * as pulumi from "@pulumi/pulumi";
 
-/** @deprecated Use [lambda.EventSubscription] instead */
+import { createAlarms, FunctionAlarms, FunctionAlarmsArgs } from "./alarms";
+import { childOptions } from "./utils";
+
+/**
+ * Base type for all subscription types.  Subclasses are responsible for creating [func] and [permission] as children
+ * of the subscription once the component itself has been constructed.
+ */
 export class EventSubscription extends pulumi.ComponentResource {
     public permission: lambda.Permission;
     public func: lambda.Function;
+    /**
+     * The role created for [func], unless an existing function or role was supplied.  Useful for granting the
+     * handler access to further resources.
+     */
+    public role?: iam.Role;
+    /**
+     * The event source mapping polling the source for [func], for sources read through one (queues and streams).
+     */
+    public eventSourceMapping?: lambda.EventSourceMapping;
+    /**
+     * The resource delivering events from the source to [func], for sources that push events to it, i.e. the topic
+     * subscription or event rule target.
+     */
+    public subscription?: pulumi.CustomResource;
+    /**
+     * The URL of [func], if it was created with [FunctionArgs.functionUrl].
+     */
+    public functionUrl?: pulumi.Output<string>;
 
-    public constructor(
-        type: string, name: string, func: lambda.Function, props: Record<string, any>, opts?: pulumi.ResourceOptions) {
+    private readonly subscriptionName: string;
+    private readonly subscriptionOpts?: pulumi.ComponentResourceOptions;
 
+    public constructor(type: string, name: string, props: Record<string, any>, opts?: pulumi.ComponentResourceOptions) {
         super(type, name, props, opts);
+        this.subscriptionName = name;
+        this.subscriptionOpts = opts;
+    }
+
+    /**
+     * addAlarms creates CloudWatch alarms on [func]'s errors, and optionally its throttles and duration, notifying
+     * [args.topicArn] when they fire.
+     */
+    public addAlarms(args: FunctionAlarmsArgs): FunctionAlarms {
+        return createAlarms(this.subscriptionName, this.func, args, childOptions(this, this.subscriptionOpts));
+    }
+}
+
+/**
+ * Filters restricting which records from an event source mapping invoke the function.  Each pattern is either a JSON
+ * filter pattern, or an object which is serialized to one.  See
+ * https://docs.aws.amazon.com/lambda/latest/dg/invocation-eventfiltering.html for the pattern syntax.
+ */
+export interface FilterCriteria {
+    filters: { pattern: string | Record<string, any> }[];
+}
+
+// serializeFilterCriteria converts [criteria] into the shape expected by aws.lambda.EventSourceMapping.filterCriteria.
+export function serializeFilterCriteria(criteria: pulumi.Input<FilterCriteria>) {
+    return pulumi.output(criteria).apply(c => ({
+        filters: c.filters.map(f => ({
+            pattern: typeof f.pattern === "string" ? f.pattern : JSON.stringify(f.pattern),
+        })),
+    }));
+}
+
+/**
+ * Options controlling how Kinesis and DynamoDB stream subscriptions handle records the function fails to process.
+ * By default a failing batch is retried until its records expire, blocking the rest of the shard.
+ */
+export interface StreamRetryArgs {
+    /**
+     * The maximum number of times a failing batch is retried, up to 10000.  Defaults to -1 (retry until the records
+     * expire).
+     */
+    maximumRetryAttempts?: pulumi.Input<number>;
+
+    /**
+     * The maximum age, in seconds, of records sent to the function, between 60 and 604800.  Older records are
+     * discarded.  Defaults to -1 (no maximum).
+     */
+    maximumRecordAgeInSeconds?: pulumi.Input<number>;
+
+    /**
+     * Whether to split a failing batch in two and retry each half separately, isolating the records responsible.
+     */
+    bisectBatchOnFunctionError?: pulumi.Input<boolean>;
+
+    /**
+     * The ARN of an SQS queue or SNS topic to send details of discarded batches to.  When the role is created on the
+     * caller's behalf it is also granted permission to deliver to the destination.
+     */
+    discardedBatchDestination?: pulumi.Input<string>;
+}
+
+/**
+ * The response a queue or stream handler may return when its subscription sets [reportBatchItemFailures], listing the
+ * records that failed.  Only those records are retried; the rest of the batch is treated as processed.
+ */
+export interface BatchItemFailuresResponse {
+    batchItemFailures: {
+        // The message ID (SQS) or sequence number (Kinesis and DynamoDB) of the failed record.
+        itemIdentifier: string;
+    }[];
+}
+
+// functionResponseTypes returns the aws.lambda.EventSourceMapping.functionResponseTypes for a subscription's
+// [reportBatchItemFailures] option.
+export function functionResponseTypes(reportBatchItemFailures: pulumi.Input<boolean> | undefined) {
+    if (reportBatchItemFailures === undefined) {
+        return undefined;
+    }
+    return pulumi.output(reportBatchItemFailures).apply(report => report ? ["ReportBatchItemFailures"] : []);
+}
+
+/**
+ * The fields Lambda adds to the event passed to a Kinesis or DynamoDB stream handler when its subscription sets
+ * [tumblingWindowInSeconds].  Records are grouped into consecutive windows of that length, and [state] is carried
+ * from one invocation to the next within a window.
+ */
+export interface TumblingWindowEventFields {
+    window: {
+        start: string;
+        end: string;
+    };
+    // The state returned by the previous invocation for this window, or an empty object for the first.
+    state: Record<string, any>;
+    shardId: string;
+    eventSourceARN: string;
+    // Set on the final invocation for a window, once all of its records have been processed.
+    isFinalInvokeForWindow: boolean;
+    isWindowTerminatedEarly: boolean;
+}
+
+/**
+ * The response a tumbling window handler returns, carrying its [state] on to the next invocation for the window.
+ */
+export interface TumblingWindowResponse extends Partial<BatchItemFailuresResponse> {
+    state: Record<string, any>;
+}
+
+// checkTumblingWindow validates a stream subscription's [tumblingWindowInSeconds], throwing immediately if it is a
+// known number and otherwise once its value is.
+export function checkTumblingWindow(
+    name: string, tumblingWindow: pulumi.Input<number> | undefined): pulumi.Output<number> | undefined {
+
+    if (tumblingWindow === undefined) {
+        return undefined;
+    }
+
+    const check = (window: number) => {
+        if (window < 0 || window > 900) {
+            throw new Error(
+                `Subscription '${name}' has a tumblingWindowInSeconds of ${window}, ` +
+                `but Lambda only supports values between 0 and 900.`);
+        }
+        return window;
+    };
+    if (typeof tumblingWindow === "number") {
+        check(tumblingWindow);
+    }
+    return pulumi.output(tumblingWindow).apply(check);
+}
+
+// checkBatchingWindow validates a subscription's [maximumBatchingWindowInSeconds], throwing immediately if it is a
+// known number and otherwise once its value is.
+export function checkBatchingWindow(
+    name: string, batchingWindow: pulumi.Input<number> | undefined): pulumi.Output<number> | undefined {
+
+    if (batchingWindow === undefined) {
+        return undefined;
+    }
+
+    const check = (window: number) => {
+        if (window < 0 || window > 300) {
+            throw new Error(
+                `Subscription '${name}' has a maximumBatchingWindowInSeconds of ${window}, ` +
+                `but Lambda only supports values between 0 and 300.`);
+        }
+        return window;
+    };
+    if (typeof batchingWindow === "number") {
+        check(batchingWindow);
+    }
+    return pulumi.output(batchingWindow).apply(check);
+}
+
+// checkMaximumRetryAttempts validates a stream subscription's [maximumRetryAttempts], throwing immediately if it is a
+// known number and otherwise once its value is.
+export function checkMaximumRetryAttempts(
+    name: string, retryAttempts: pulumi.Input<number> | undefined): pulumi.Output<number> | undefined {
+
+    if (retryAttempts === undefined) {
+        return undefined;
+    }
+
+    const check = (attempts: number) => {
+        if (attempts < -1 || attempts > 10000) {
+            throw new Error(
+                `Subscription '${name}' has a maximumRetryAttempts of ${attempts}, ` +
+                `but Lambda only supports values between -1 (retry until the records expire) and 10000.`);
+        }
+        return attempts;
+    };
+    if (typeof retryAttempts === "number") {
+        check(retryAttempts);
+    }
+    return pulumi.output(retryAttempts).apply(check);
+}
+
+// checkMaximumRecordAge validates a stream subscription's [maximumRecordAgeInSeconds], throwing immediately if it is a
+// known number and otherwise once its value is.
+export function checkMaximumRecordAge(
+    name: string, recordAge: pulumi.Input<number> | undefined): pulumi.Output<number> | undefined {
+
+    if (recordAge === undefined) {
+        return undefined;
+    }
+
+    const check = (age: number) => {
+        if (age !== -1 && (age < 60 || age > 604800)) {
+            throw new Error(
+                `Subscription '${name}' has a maximumRecordAgeInSeconds of ${age}, ` +
+                `but Lambda only supports -1 (no maximum) or values between 60 and 604800.`);
+        }
+        return age;
+    };
+    if (typeof recordAge === "number") {
+        check(recordAge);
+    }
+    return pulumi.output(recordAge).apply(check);
+}
+
+// maxStreamBatchSize is the largest batch Lambda reads from Kinesis and DynamoDB streams.
+export const maxStreamBatchSize = 10000;
+
+// checkBatchSize validates a subscription's [batchSize] against the largest batch [source] supports, throwing
+// immediately if both are known numbers and otherwise once their values are.  [hint] follows the error, i.e. to
+// explain how larger batches can be allowed.
+export function checkBatchSize(
+    name: string, source: string, batchSize: pulumi.Input<number> | undefined, max: pulumi.Input<number>,
+    hint = ""): pulumi.Output<number> | undefined {
+
+    if (batchSize === undefined) {
+        return undefined;
+    }
 
-        this.func = func;
+    const check = (size: number, limit: number) => {
+        if (size < 1 || size > limit) {
+            throw new Error(
+                `Subscription '${name}' has a batchSize of ${size}, ` +
+                `but ${source} only supports values between 1 and ${limit}.${hint}`);
+        }
+        return size;
+    };
+    if (typeof batchSize === "number" && typeof max === "number") {
+        check(batchSize, max);
     }
+    return pulumi.all([batchSize, max]).apply(([size, limit]) => check(size, limit));
 }
@@ -0,0 +1,163 @@
+// Copyright 2016-2018, Pulumi Corporation.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+import * as aws from "@pulumi/aws";
+import * as pulumi from "@pulumi/pulumi";
+
+import { CloudwatchEventArgs, CloudwatchEventHandler, CloudwatchEventSubscription, onEvent } from "./cloudwatch";
+import { createFunction } from "./function";
+import { EventSubscription } from "./subscription";
+import { childOptions, mergeTags } from "./utils";
+
+export interface TimerArgs extends CloudwatchEventArgs {
+    /**
+     * The IANA name of the timezone (i.e. "America/New_York") the cron expression is evaluated in.  EventBridge rules
+     * only support UTC, so when a timezone is given the schedule is created with EventBridge Scheduler instead.
+     */
+    timezone?: string;
+}
+
+export type TimerSubscription = CloudwatchEventSubscription | ScheduleEventSubscription;
+
+/**
+ * Creates a new subscription that invokes the handler provided whenever the given cron expression (i.e.
+ * "0 9 * * ? *") fires.  See https://docs.aws.amazon.com/eventbridge/latest/userguide/eb-cron-expressions.html for the
+ * expression syntax.
+ */
+export function cron(
+    name: string, cronExpression: string, handler: CloudwatchEventHandler,
+    args?: TimerArgs, opts?: pulumi.ComponentResourceOptions): TimerSubscription {
+
+    args = args || {};
+    if (args.timezone === undefined) {
+        return onEvent(name, `cron(${cronExpression})`, handler, args, opts);
+    }
+
+    return new ScheduleEventSubscription(name, `cron(${cronExpression})`, handler, args, opts);
+}
+
+/**
+ * Creates a new subscription that invokes the handler provided at the given rate (i.e. "5 minutes").
+ */
+export function rate(
+    name: string, rateExpression: string, handler: CloudwatchEventHandler,
+    args?: CloudwatchEventArgs, opts?: pulumi.ComponentResourceOptions): CloudwatchEventSubscription {
+
+    return onEvent(name, `rate(${rateExpression})`, handler, args, opts);
+}
+
+/**
+ * Creates a new subscription that invokes the handler provided once, at the given time.  The schedule is created with
+ * EventBridge Scheduler, and is left in place after it fires.  Times in the past are warned about rather than
+ * rejected, so that the program can still be deployed once the schedule has fired.
+ */
+export function at(
+    name: string, date: Date, handler: CloudwatchEventHandler,
+    args?: CloudwatchEventArgs, opts?: pulumi.ComponentResourceOptions): ScheduleEventSubscription {
+
+    if (isNaN(date.getTime())) {
+        throw new Error(`Subscription '${name}' must be given a valid date to fire at.`);
+    }
+    if (date.getTime() <= Date.now()) {
+        pulumi.log.warn(
+            `Subscription '${name}' is scheduled at ${date.toISOString()}, which has already passed.  ` +
+            `Remove it once it has fired.`);
+    }
+
+    // One-time schedules take the time in UTC as yyyy-mm-ddThh:mm:ss, without milliseconds or a timezone offset.
+    return new ScheduleEventSubscription(name, `at(${date.toISOString().substring(0, 19)})`, handler, args || {}, opts);
+}
+
+const schedulerRolePolicy = {
+    "Version": "2012-10-17",
+    "Statement": [
+        {
+            "Action": "sts:AssumeRole",
+            "Principal": {
+                "Service": "scheduler.amazonaws.com",
+            },
+            "Effect": "Allow",
+            "Sid": "",
+        },
+    ],
+};
+
+/**
+ * A subscription driven by an aws.scheduler.Schedule rather than an aws.cloudwatch.EventRule, used for schedules
+ * that must be evaluated in a specific timezone and for one-time schedules.
+ */
+export class ScheduleEventSubscription extends EventSubscription {
+    public readonly schedule: aws.scheduler.Schedule;
+    public readonly schedulerRole: aws.iam.Role;
+
+    public constructor(
+        name: string, scheduleExpression: string, handler: CloudwatchEventHandler,
+        args: TimerArgs, opts?: pulumi.ComponentResourceOptions) {
+
+        super("aws-serverless:timer:ScheduleEventSubscription", name, {}, opts);
+
+        if (args.timezone !== undefined) {
+            validateTimezone(args.timezone);
+        }
+
+        const { func, role, functionUrl, targetArn } = createFunction(
+            name + "-schedule-subscription", { subscription: name, source: "schedule" },
+            handler, args, childOptions(this, opts));
+        this.func = func;
+        this.role = role;
+        this.functionUrl = functionUrl && functionUrl.functionUrl;
+
+        // Unlike EventBridge rules, schedules invoke their target by assuming a role rather than through a resource
+        // policy on the function.
+        this.schedulerRole = new aws.iam.Role(name + "-scheduler", {
+            assumeRolePolicy: JSON.stringify(schedulerRolePolicy),
+            tags: mergeTags(args.tags),
+        }, childOptions(this, opts));
+
+        const invokePolicy = new aws.iam.RolePolicy(name + "-scheduler", {
+            role: this.schedulerRole,
+            policy: targetArn.apply(arn => JSON.stringify({
+                Version: "2012-10-17",
+                Statement: [{
+                    Effect: "Allow",
+                    Action: "lambda:InvokeFunction",
+                    Resource: arn,
+                }],
+            })),
+        }, childOptions(this, opts));
+
+        this.schedule = new aws.scheduler.Schedule(name, {
+            scheduleExpression: scheduleExpression,
+            scheduleExpressionTimezone: args.timezone,
+            flexibleTimeWindow: { mode: "OFF" },
+            target: {
+                arn: targetArn,
+                roleArn: this.schedulerRole.arn,
+            },
+        }, childOptions(this, opts, [invokePolicy]));
+
+        this.subscription = this.schedule;
+
+        this.registerOutputs();
+    }
+}
+
+// validateTimezone throws if [timezone] is not an IANA timezone name known to the runtime.
+function validateTimezone(timezone: string) {
+    try {
+        new Intl.DateTimeFormat("en-US", { timeZone: timezone }).format();
+    } catch (err) {
+        throw new Error(`'${timezone}' is not a valid IANA timezone name.`);
+    }
+}
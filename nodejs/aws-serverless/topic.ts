@@ -12,32 +12,343 @@
 // See the License for the specific language governing permissions and
 // limitations under the License.
 
+import * as aws from "@pulumi/aws";
 import * as pulumi from "@pulumi/pulumi";
 
-import { sns } from "@pulumi/aws";
-
-/** @deprecated Use [sns.TopicEvent] instead */
-export type TopicEvent = sns.TopicEvent;
-/** @deprecated Use [sns.TopicRecord] instead */
-export type TopicRecord = sns.TopicRecord;
-/** @deprecated Use [sns.SNSItem] instead */
-export type SNSItem = sns.SNSItem;
-/** @deprecated Use [sns.SNSMessageAttribute] instead */
-export type SNSMessageAttribute = sns.SNSMessageAttribute;
-/** @deprecated Use [sns.TopicEventHandler] instead */
-export type TopicEventHandler = sns.TopicEventHandler;
-/** @deprecated Use [sns.TopicSubscriptionArgs] instead */
-export type TopicSubscriptionArgs = sns.TopicSubscriptionArgs;
-
-/** @deprecated Use [sns.Topic.onEvent] instead */
+import { createFunction, FunctionArgs, Handler } from "./function";
+import { EventSubscription } from "./subscription";
+import { childOptions } from "./utils";
+
+export interface TopicEvent {
+    Records: TopicRecord[];
+}
+
+/** An alias for [TopicEvent], matching the name AWS uses for this event. */
+export type SNSEvent = TopicEvent;
+
+export interface TopicRecord {
+    EventVersion: string;
+    EventSubscriptionArn: string;
+    EventSource: string;
+    Sns: SNSItem;
+}
+
+export interface SNSItem {
+    SignatureVersion: string;
+    Timestamp: string;
+    Signature: string;
+    SigningCertUrl: string;
+    MessageId: string;
+    Message: string;
+    MessageAttributes: { [key: string]: SNSMessageAttribute };
+    Type: string;
+    UnsubscribeUrl: string;
+    TopicArn: string;
+    Subject?: string;
+}
+
+export interface SNSMessageAttribute {
+    Type: string;
+    Value: string;
+}
+
+export type TopicEventHandler = Handler<TopicEvent, void>;
+
+/**
+ * An SNS subscription filter policy, mapping message attribute names to the values a message's attribute must match
+ * for it to be delivered.  See https://docs.aws.amazon.com/sns/latest/dg/message-filtering.html for the full syntax.
+ */
+export interface TopicFilterPolicy {
+    [attribute: string]: (string | number | boolean | Record<string, any>)[];
+}
+
+/**
+ * Where SNS sends the messages it fails to deliver to a subscription, once its retries are exhausted.
+ */
+export interface TopicRedrivePolicy {
+    /**
+     * The ARN of the SQS queue to send undeliverable messages to.  The queue's policy is replaced with one allowing
+     * every topic in the program that sends to the queue to do so, so it may be shared by several subscriptions.
+     */
+    deadLetterTargetArn: string;
+}
+
+export interface TopicSubscriptionArgs extends FunctionArgs {
+    /**
+     * An optional filter policy restricting which messages published to the topic are delivered to the handler.
+     * Plain objects are serialized to JSON; strings are assumed to already be a JSON policy document.
+     */
+    filterPolicy?: pulumi.Input<string | TopicFilterPolicy>;
+
+    /**
+     * Sends messages that can't be delivered to the handler to a dead-letter queue.  Note that raw message delivery
+     * isn't offered, as SNS doesn't support it for functions.
+     */
+    redrivePolicy?: pulumi.Input<TopicRedrivePolicy>;
+}
+
+/**
+ * Creates a new subscription to the given topic using the handler provided, along with optional options to control
+ * the behavior of the subscription.
+ */
 export function subscribe(
-    name: string, topic: sns.Topic, handler: TopicEventHandler,
-    args?: TopicSubscriptionArgs, opts?: pulumi.ResourceOptions): TopicEventSubscription {
+    name: string, topic: aws.sns.Topic, handler: TopicEventHandler,
+    args?: TopicSubscriptionArgs, opts?: pulumi.ComponentResourceOptions): TopicEventSubscription {
+
+    return new TopicEventSubscription(name, topic, handler, args, opts);
+}
+
+export class TopicEventSubscription extends EventSubscription {
+    public readonly topic: aws.sns.Topic;
+    public readonly subscription: aws.sns.TopicSubscription;
+
+    public constructor(
+        name: string, topic: aws.sns.Topic, handler: TopicEventHandler,
+        args?: TopicSubscriptionArgs, opts?: pulumi.ComponentResourceOptions) {
+
+        super("aws-serverless:topic:TopicEventSubscription", name, { topic: topic }, opts);
+
+        args = args || {};
+
+        this.topic = topic;
+        const { func, role, functionUrl, targetArn } = createFunction(
+            name + "-topic-subscription", { subscription: name, source: "topic" },
+            handler, args, childOptions(this, opts));
+        this.func = func;
+        this.role = role;
+        this.functionUrl = functionUrl && functionUrl.functionUrl;
+
+        this.permission = new aws.lambda.Permission(name, {
+            function: targetArn,
+            action: "lambda:invokeFunction",
+            principal: "sns.amazonaws.com",
+            sourceArn: topic.id,
+        }, childOptions(this, opts));
+
+        this.subscription = new aws.sns.TopicSubscription(name, {
+            topic: topic,
+            protocol: "lambda",
+            endpoint: targetArn,
+            filterPolicy: args.filterPolicy === undefined ? undefined : serializeFilterPolicy(args.filterPolicy),
+            redrivePolicy: args.redrivePolicy === undefined
+                ? undefined : serializeRedrivePolicy(name, this, topic, args.redrivePolicy, opts),
+        }, childOptions(this, opts));
+
+        this.registerOutputs();
+    }
+}
+
+export interface TopicQueueSubscriptionArgs {
+    /**
+     * Whether to deliver the raw message published to the topic, rather than the JSON SNS envelope wrapping it.
+     */
+    rawMessageDelivery?: pulumi.Input<boolean>;
+
+    /**
+     * An optional filter policy restricting which messages published to the topic are delivered to the queue.
+     */
+    filterPolicy?: pulumi.Input<string | TopicFilterPolicy>;
+
+    /**
+     * Sends messages that can't be delivered to the queue, i.e. while it is unavailable, to a dead-letter queue.
+     */
+    redrivePolicy?: pulumi.Input<TopicRedrivePolicy>;
+}
+
+/**
+ * Subscribes the given queue to the topic, so that every message published to the topic is also sent to the queue.
+ * Together with queue.subscribe, this fans a topic out to a handler per queue.  Note that the queue's policy is
+ * replaced with one allowing every topic in the program subscribed to the queue, or using it as a dead-letter queue,
+ * to send to it, which is named after the first of those subscriptions.
+ */
+export function subscribeQueue(
+    name: string, topic: aws.sns.Topic, queue: aws.sqs.Queue,
+    args?: TopicQueueSubscriptionArgs, opts?: pulumi.ComponentResourceOptions): TopicQueueSubscription {
+
+    return new TopicQueueSubscription(name, topic, queue, args, opts);
+}
 
-    return topic.onEvent(name, handler, args, opts);
+export class TopicQueueSubscription extends pulumi.ComponentResource {
+    public readonly topic: aws.sns.Topic;
+    public readonly queue: aws.sqs.Queue;
+    public readonly subscription: aws.sns.TopicSubscription;
+
+    public constructor(
+        name: string, topic: aws.sns.Topic, queue: aws.sqs.Queue,
+        args?: TopicQueueSubscriptionArgs, opts?: pulumi.ComponentResourceOptions) {
+
+        super("aws-serverless:topic:TopicQueueSubscription", name, { topic: topic, queue: queue }, opts);
+
+        args = args || {};
+
+        this.topic = topic;
+        this.queue = queue;
+
+        // Messages published before the policy is in place would be dropped, so only subscribe once it is.
+        const queueUrl = allowTopicToSend(name, queue, topic, childOptions(this, opts));
+        this.subscription = new aws.sns.TopicSubscription(name, {
+            topic: topic,
+            protocol: "sqs",
+            endpoint: pulumi.all([queue.arn, queueUrl]).apply(([queueArn]) => queueArn),
+            rawMessageDelivery: args.rawMessageDelivery,
+            filterPolicy: args.filterPolicy === undefined ? undefined : serializeFilterPolicy(args.filterPolicy),
+            redrivePolicy: args.redrivePolicy === undefined
+                ? undefined : serializeRedrivePolicy(name, this, topic, args.redrivePolicy, opts),
+        }, childOptions(this, opts));
+
+        this.registerOutputs();
+    }
+}
+
+function serializeFilterPolicy(policy: pulumi.Input<string | TopicFilterPolicy>): pulumi.Output<string> {
+    return pulumi.output(policy).apply(p => typeof p === "string" ? p : JSON.stringify(p));
+}
+
+// serializeRedrivePolicy returns [policy] as the JSON SNS expects, once the topic has been allowed to send to its
+// dead-letter queue.
+function serializeRedrivePolicy(
+    name: string, parent: pulumi.Resource, topic: aws.sns.Topic, policy: pulumi.Input<TopicRedrivePolicy>,
+    opts: pulumi.ComponentResourceOptions | undefined): pulumi.Output<string> {
+
+    const deadLetterArn = pulumi.output(policy).apply(p => p.deadLetterTargetArn);
+    const queueUrl = allowTopicToSendToDeadLetter(name, deadLetterArn, topic, childOptions(parent, opts));
+
+    // Depending on the queue policy's URL ensures the topic can send to the queue before it is asked to.
+    return pulumi.all([policy, queueUrl]).apply(([p]) => JSON.stringify(p));
+}
+
+interface QueuePolicyInfo {
+    // The name of the first subscription needing the policy, which it is named after.
+    name: string;
+    // The options of that subscription, which the policy is created with.
+    opts: pulumi.CustomResourceOptions;
+    queueArn: pulumi.Input<string>;
+    queueUrl: pulumi.Input<string>;
+    // The ARNs of the topics allowed to send to the queue.
+    topicArns: pulumi.Output<string>[];
+    policy?: aws.sqs.QueuePolicy;
+    // Resolves to the policy's queue URL once the policy has been created.
+    created: Promise<pulumi.Output<string>>;
+    resolveCreated: (queueUrl: pulumi.Output<string>) => void;
+}
+
+// An SQS queue has a single policy, which a QueuePolicy replaces wholesale.  So rather than having every subscription
+// create its own QueuePolicy for the queue it sends to (clobbering the others), we record the topics allowed to send to
+// each queue here, keyed by the queue's URN, and create one merged policy per queue once the program has finished
+// registering its subscriptions.
+const queuePolicyInfos = new Map<string, QueuePolicyInfo>();
+
+// Dead-letter queues are only known by their ARN, so the topics allowed to send to them are recorded separately, keyed
+// by the ARN.  A dead-letter queue that is also subscribed to a topic shares the subscribed queue's policy.
+const deadLetterPolicyInfos = new Map<string, QueuePolicyInfo>();
+
+// The ARNs of the queues in [queuePolicyInfos], keyed by their URN, once known.
+const queueArns = new Map<string, string>();
+
+process.on("beforeExit", createQueuePolicies);
+
+function createQueuePolicies() {
+    // Dead-letter queues that are also subscribed to a topic take the subscribed queue's policy, once its ARN is known.
+    for (const [queueArn, deadLetterInfo] of deadLetterPolicyInfos) {
+        for (const [urn, arn] of queueArns) {
+            const info = queuePolicyInfos.get(urn)!;
+            if (arn === queueArn && !deadLetterInfo.policy && !info.policy) {
+                info.topicArns.push(...deadLetterInfo.topicArns);
+                deadLetterPolicyInfos.set(queueArn, info);
+                info.created.then(deadLetterInfo.resolveCreated);
+            }
+        }
+    }
+
+    for (const info of [...queuePolicyInfos.values(), ...deadLetterPolicyInfos.values()]) {
+        if (info.policy) {
+            continue;
+        }
+
+        info.policy = new aws.sqs.QueuePolicy(info.name, {
+            queueUrl: info.queueUrl,
+            policy: pulumi.all([info.queueArn, ...info.topicArns]).apply(([queueArn, ...topicArns]) => JSON.stringify({
+                Version: "2012-10-17",
+                Statement: topicArns.filter((arn, i) => topicArns.indexOf(arn) === i).map(topicArn => ({
+                    Effect: "Allow",
+                    Principal: { Service: "sns.amazonaws.com" },
+                    Action: "sqs:SendMessage",
+                    Resource: queueArn,
+                    Condition: {
+                        ArnEquals: { "aws:SourceArn": topicArn },
+                    },
+                })),
+            })),
+        }, info.opts);
+        info.resolveCreated(info.policy.queueUrl);
+    }
+}
+
+// newQueuePolicyInfo returns the record of a policy for a queue, to be created for subscription [name].
+function newQueuePolicyInfo(
+    name: string, queueArn: pulumi.Input<string>, queueUrl: pulumi.Input<string>,
+    opts: pulumi.CustomResourceOptions): QueuePolicyInfo {
+
+    let resolveCreated!: (queueUrl: pulumi.Output<string>) => void;
+    const created = new Promise<pulumi.Output<string>>(r => resolveCreated = r);
+    return {
+        name: name, opts: opts, queueArn: queueArn, queueUrl: queueUrl, topicArns: [],
+        created: created, resolveCreated: resolveCreated,
+    };
+}
+
+// allowTopicToSend records that subscription [name] needs [topic] to be allowed to send to [queue], returning the
+// queue's URL once the policy allowing it has been created.
+function allowTopicToSend(
+    name: string, queue: aws.sqs.Queue, topic: aws.sns.Topic,
+    opts: pulumi.CustomResourceOptions): pulumi.Output<string> {
+
+    return queue.urn.apply(urn => {
+        let info = queuePolicyInfos.get(urn);
+        if (!info) {
+            info = newQueuePolicyInfo(name, queue.arn, queue.id, opts);
+            queuePolicyInfos.set(urn, info);
+            queue.arn.apply(arn => queueArns.set(urn, arn));
+        }
+
+        if (info.policy) {
+            throw new Error(
+                `Subscription '${name}' was added to queue '${urn}' after the queue's policy was created.`);
+        }
+
+        info.topicArns.push(topic.arn);
+        return pulumi.output(info.created);
+    });
 }
 
-/** @deprecated Use [sns.TopicEventSubscription] instead */
-export const TopicEventSubscription = sns.TopicEventSubscription;
-/** @deprecated Use [sns.TopicEventSubscription] instead */
-export type TopicEventSubscription = sns.TopicEventSubscription;
+// allowTopicToSendToDeadLetter records that subscription [name] needs [topic] to be allowed to send to the dead-letter
+// queue [queueArn], returning the queue's URL once the policy allowing it has been created.
+function allowTopicToSendToDeadLetter(
+    name: string, queueArn: pulumi.Output<string>, topic: aws.sns.Topic,
+    opts: pulumi.CustomResourceOptions): pulumi.Output<string> {
+
+    return queueArn.apply(arn => {
+        let info = deadLetterPolicyInfos.get(arn);
+        if (!info) {
+            info = newQueuePolicyInfo(name + "-dead-letter", arn, queueUrlFromArn(arn), opts);
+            deadLetterPolicyInfos.set(arn, info);
+        }
+
+        if (info.policy) {
+            throw new Error(
+                `Subscription '${name}' uses queue '${arn}' as its dead-letter queue after the queue's policy was ` +
+                `created.`);
+        }
+
+        info.topicArns.push(topic.arn);
+        return pulumi.output(info.created);
+    });
+}
+
+// queueUrlFromArn returns the URL of the SQS queue with the given ARN.
+function queueUrlFromArn(arn: string): string {
+    // ARNs have the form arn:<partition>:sqs:<region>:<account>:<name>.
+    const [, partition, , region, account, queueName] = arn.split(":");
+    const domain = partition === "aws-cn" ? "amazonaws.com.cn" : "amazonaws.com";
+    return `https://sqs.${region}.${domain}/${account}/${queueName}`;
+}
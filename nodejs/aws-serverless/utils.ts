@@ -23,3 +23,38 @@ export function sha1hash(s: string): string {
     //     to collisions.  For now, limit the size of hashes to ensure we generate shorter/ resource names.
     return shasum.digest("hex").substring(0, 8);
 }
+
+let defaultTags: Record<string, pulumi.Input<string>> = {};
+
+/**
+ * setDefaultTags sets tags to apply to every taggable resource subsequently created by this package.  Tags passed to
+ * an individual helper are merged with, and take precedence over, these defaults.
+ */
+export function setDefaultTags(tags: Record<string, pulumi.Input<string>>) {
+    defaultTags = { ...tags };
+}
+
+// mergeTags returns the default tags overlaid with [tags].
+export function mergeTags(
+    tags?: pulumi.Input<Record<string, pulumi.Input<string>>>): pulumi.Output<Record<string, string>> {
+
+    return pulumi.all([pulumi.output(defaultTags), pulumi.output(tags || {})]).apply(
+        ([defaults, overrides]) => ({ ...defaults, ...overrides }));
+}
+
+// childOptions returns the options for a resource created by the component [parent], which was itself created with
+// [opts].  The resource is parented to the component, uses the provider the component was given, and waits on the
+// resources the component was declared to depend on as well as [dependsOn].
+export function childOptions(
+    parent: pulumi.Resource, opts: pulumi.ResourceOptions | undefined,
+    dependsOn?: pulumi.Resource[]): pulumi.CustomResourceOptions {
+
+    const inherited = opts && opts.dependsOn;
+    const dependencies = (inherited === undefined ? [] : Array.isArray(inherited) ? inherited : [inherited])
+        .concat(dependsOn || []);
+    return {
+        parent: parent,
+        provider: opts && opts.provider,
+        dependsOn: dependencies.length > 0 ? dependencies : undefined,
+    };
+}